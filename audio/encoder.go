@@ -0,0 +1,80 @@
+package audio
+
+import (
+	"io"
+
+	"github.com/go-audio/audio"
+	"github.com/go-audio/wav"
+)
+
+// Encoder writes interleaved int16 PCM samples to w in a specific
+// container/codec, replacing the per-extension `sox` invocations.
+type Encoder interface {
+	// Extension is the file extension this encoder produces, e.g. "wav".
+	Extension() string
+	// Encode writes samples (interleaved per-channel int16 frames) to w.
+	Encode(w io.Writer, samples []int16, format Format) error
+}
+
+// WAVEncoder writes PCM samples as a canonical RIFF/WAVE file via
+// go-audio/wav.
+type WAVEncoder struct{}
+
+// Extension implements Encoder.
+func (WAVEncoder) Extension() string { return "wav" }
+
+// Encode implements Encoder.
+func (WAVEncoder) Encode(w io.Writer, samples []int16, format Format) error {
+	ws, ok := w.(io.WriteSeeker)
+	if !ok {
+		return errNeedsSeeker("wav")
+	}
+
+	enc := wav.NewEncoder(ws, format.SampleRate, format.BitDepth, format.Channels, 1)
+
+	buf := &audio.IntBuffer{
+		Format: &audio.Format{
+			SampleRate:  format.SampleRate,
+			NumChannels: format.Channels,
+		},
+		Data:           make([]int, len(samples)),
+		SourceBitDepth: format.BitDepth,
+	}
+	for i, s := range samples {
+		buf.Data[i] = int(s)
+	}
+
+	if err := enc.Write(buf); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// OGGEncoder writes PCM samples as an Opus-in-Ogg stream via hraban/opus,
+// replacing `sox ... data.ogg`. hraban/opus is a cgo binding to libopus,
+// so Encode's actual implementation (and the libopus/pkg-config
+// requirement that comes with it) lives behind a build tag - see
+// ogg_cgo.go for CGO_ENABLED=1 builds and ogg_nocgo.go for the
+// CGO_ENABLED=0 stub.
+type OGGEncoder struct {
+	// Bitrate is the target Opus bitrate in bits/second.
+	Bitrate int
+	// Comments are embedded in the OpusTags packet as Vorbis Comments,
+	// e.g. ARTIST, TITLE, REPLAYGAIN_TRACK_GAIN.
+	Comments map[string]string
+}
+
+// Extension implements Encoder.
+func (OGGEncoder) Extension() string { return "ogg" }
+
+func errNeedsSeeker(format string) error {
+	return &encoderError{format: format}
+}
+
+type encoderError struct {
+	format string
+}
+
+func (e *encoderError) Error() string {
+	return "audio: " + e.format + " encoder requires an io.WriteSeeker destination"
+}
@@ -0,0 +1,187 @@
+//go:build cgo
+
+// This file implements OGGEncoder.Encode for CGO_ENABLED=1 builds, where
+// hraban/opus's cgo binding to libopus is available. See ogg_nocgo.go for
+// the CGO_ENABLED=0 stub, and audio/format.go's package doc for why this
+// is a cgo/libopus dependency rather than a pure-Go one.
+package audio
+
+import (
+	"encoding/binary"
+	"io"
+	"sort"
+
+	"github.com/hraban/opus"
+)
+
+// oggFrameMillis is the Opus frame size used for each encoded packet.
+const oggFrameMillis = 20
+
+// oggCRC computes the Ogg page checksum: CRC-32 with polynomial
+// 0x04c11db7, no reflection, initial value 0 and no final XOR.
+func oggCRC(data []byte) uint32 {
+	crc := uint32(0)
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = (crc << 1) ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// Encode implements Encoder.
+func (e OGGEncoder) Encode(w io.Writer, samples []int16, format Format) error {
+	bitrate := e.Bitrate
+	if bitrate == 0 {
+		bitrate = 160000
+	}
+
+	enc, err := opus.NewEncoder(format.SampleRate, format.Channels, opus.AppAudio)
+	if err != nil {
+		return err
+	}
+	if err := enc.SetBitrate(bitrate); err != nil {
+		return err
+	}
+
+	return writeOggOpusStream(w, enc, samples, format, e.Comments)
+}
+
+// writeOggOpusStream encodes samples with enc and packages the resulting
+// Opus packets into a minimal single-stream Ogg container (OpusHead,
+// OpusTags, then one page per audio packet), which is what ffmpeg/players
+// expect to find in a `.ogg` file.
+func writeOggOpusStream(w io.Writer, enc *opus.Encoder, samples []int16, format Format, comments map[string]string) error {
+	serial := uint32(1)
+	pageSeq := uint32(0)
+
+	if err := writeOggPage(w, serial, pageSeq, 0, 0x02, opusHeadPacket(format)); err != nil {
+		return err
+	}
+	pageSeq++
+
+	if err := writeOggPage(w, serial, pageSeq, 0, 0, opusTagsPacket(comments)); err != nil {
+		return err
+	}
+	pageSeq++
+
+	frameSamples := format.SampleRate * oggFrameMillis / 1000
+	frameLen := frameSamples * format.Channels
+	granule := int64(0)
+
+	packetBuf := make([]byte, 4000)
+
+	for offset := 0; offset < len(samples); offset += frameLen {
+		end := offset + frameLen
+		frame := make([]int16, frameLen)
+		if end > len(samples) {
+			copy(frame, samples[offset:])
+		} else {
+			copy(frame, samples[offset:end])
+		}
+
+		n, err := enc.Encode(frame, packetBuf)
+		if err != nil {
+			return err
+		}
+
+		granule += int64(frameSamples)
+
+		headerType := byte(0)
+		if end >= len(samples) {
+			headerType = 0x04
+		}
+
+		if err := writeOggPage(w, serial, pageSeq, granule, headerType, packetBuf[:n]); err != nil {
+			return err
+		}
+		pageSeq++
+	}
+
+	return nil
+}
+
+func opusHeadPacket(format Format) []byte {
+	b := make([]byte, 19)
+	copy(b[0:8], "OpusHead")
+	b[8] = 1 // version
+	b[9] = byte(format.Channels)
+	binary.LittleEndian.PutUint16(b[10:12], 0)                         // pre-skip
+	binary.LittleEndian.PutUint32(b[12:16], uint32(format.SampleRate))  // input sample rate
+	binary.LittleEndian.PutUint16(b[16:18], 0)                         // output gain
+	b[18] = 0                                                          // channel mapping family
+	return b
+}
+
+// opusTagsPacket builds the OpusTags packet, the Vorbis Comment header
+// every Opus-in-Ogg stream carries its metadata in (RFC 7845 section 5.2).
+// comments is written as sorted FIELD=value pairs for deterministic output.
+func opusTagsPacket(comments map[string]string) []byte {
+	vendor := "alsa2fifo_indexer audio pipeline"
+
+	keys := make([]string, 0, len(comments))
+	for k := range comments {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b := make([]byte, 0, 8+4+len(vendor)+4)
+	b = append(b, "OpusTags"...)
+
+	length := make([]byte, 4)
+	binary.LittleEndian.PutUint32(length, uint32(len(vendor)))
+	b = append(b, length...)
+	b = append(b, vendor...)
+
+	binary.LittleEndian.PutUint32(length, uint32(len(keys)))
+	b = append(b, length...)
+
+	for _, k := range keys {
+		comment := k + "=" + comments[k]
+		binary.LittleEndian.PutUint32(length, uint32(len(comment)))
+		b = append(b, length...)
+		b = append(b, comment...)
+	}
+
+	return b
+}
+
+// writeOggPage writes a single-packet Ogg page. This covers the case that
+// matters here (one Opus packet per page); it does not implement lacing
+// for packets that need to span multiple pages.
+func writeOggPage(w io.Writer, serial, seq uint32, granulePos int64, headerType byte, packet []byte) error {
+	segments := (len(packet) / 255) + 1
+	header := make([]byte, 27+segments)
+
+	copy(header[0:4], "OggS")
+	header[4] = 0 // version
+	header[5] = headerType
+	binary.LittleEndian.PutUint64(header[6:14], uint64(granulePos))
+	binary.LittleEndian.PutUint32(header[14:18], serial)
+	binary.LittleEndian.PutUint32(header[18:22], seq)
+	// checksum filled in below
+	header[26] = byte(segments)
+
+	remaining := len(packet)
+	for i := 0; i < segments; i++ {
+		if remaining >= 255 {
+			header[27+i] = 255
+			remaining -= 255
+		} else {
+			header[27+i] = byte(remaining)
+		}
+	}
+
+	page := append(header, packet...)
+	binary.LittleEndian.PutUint32(page[22:26], 0)
+	crc := oggCRC(page)
+	binary.LittleEndian.PutUint32(page[22:26], crc)
+
+	_, err := w.Write(page)
+	return err
+}
@@ -0,0 +1,24 @@
+//go:build !cgo
+
+// This file stands in for ogg_cgo.go on CGO_ENABLED=0 builds, where
+// hraban/opus's cgo binding to libopus cannot be compiled in. It exists
+// so a static/cross build still links; it cannot actually produce Opus
+// output without libopus, so OGGEncoder.Encode just reports that plainly
+// instead of failing the whole build.
+package audio
+
+import (
+	"errors"
+	"io"
+)
+
+// errNeedsCGO is returned by OGGEncoder.Encode in CGO_ENABLED=0 builds.
+var errNeedsCGO = errors.New("audio: ogg encoder requires CGO_ENABLED=1 and libopus at build time (this binary was built with CGO_ENABLED=0)")
+
+// Encode implements Encoder. It always fails: encoding Opus requires
+// hraban/opus's cgo binding to libopus, which this build was compiled
+// without (CGO_ENABLED=0). Build with CGO_ENABLED=1 and libopus/
+// pkg-config available on the build host to get real "ogg" output.
+func (e OGGEncoder) Encode(w io.Writer, samples []int16, format Format) error {
+	return errNeedsCGO
+}
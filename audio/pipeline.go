@@ -0,0 +1,59 @@
+package audio
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+// Pipeline turns a raw PCM file into encoded recordings and waveform
+// artifacts, replacing the `sox`/`audiowaveform` shell-outs previously
+// performed by indexer.closeSession and fileServer.renderRequest.
+type Pipeline struct {
+	Format   Format
+	Trimmer  Trimmer
+	Encoders []Encoder
+}
+
+// NewPipeline returns a Pipeline for format with the given fade duration,
+// ready to encode with WAV and OGG encoders (the two extensions
+// closeSession previously produced via sox). Loudness normalization is
+// applied separately by the loudness package, not by the Pipeline.
+func NewPipeline(format Format, fadeSecs float64) *Pipeline {
+	return &Pipeline{
+		Format:   format,
+		Trimmer:  NewTrimmer(format, fadeSecs),
+		Encoders: []Encoder{WAVEncoder{}, OGGEncoder{}},
+	}
+}
+
+// ReadSamples decodes a raw S16LE PCM file into interleaved int16 frames.
+func ReadSamples(r io.Reader, format Format) ([]int16, error) {
+	if err := format.Validate(); err != nil {
+		return nil, err
+	}
+
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw)%2 != 0 {
+		raw = raw[:len(raw)-1]
+	}
+
+	samples := make([]int16, len(raw)/2)
+	for i := range samples {
+		samples[i] = int16(raw[2*i]) | int16(raw[2*i+1])<<8
+	}
+	return samples, nil
+}
+
+// EncoderByExtension returns the configured Encoder producing the given
+// file extension, if any.
+func (p *Pipeline) EncoderByExtension(extension string) (Encoder, bool) {
+	for _, enc := range p.Encoders {
+		if enc.Extension() == extension {
+			return enc, true
+		}
+	}
+	return nil, false
+}
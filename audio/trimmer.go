@@ -0,0 +1,80 @@
+package audio
+
+// Trimmer cuts a time range out of a S16LE PCM stream and applies a
+// linear fade-in/fade-out, replacing the `sox trim ... fade ...` pipeline.
+type Trimmer struct {
+	Format      Format
+	FadeInSecs  float64
+	FadeOutSecs float64
+}
+
+// NewTrimmer returns a Trimmer for the given format that uses fadeSecs as
+// both its fade-in and its fade-out duration.
+func NewTrimmer(format Format, fadeSecs float64) Trimmer {
+	return Trimmer{Format: format, FadeInSecs: fadeSecs, FadeOutSecs: fadeSecs}
+}
+
+// Trim extracts the frames in [startSecs, endSecs) from samples (interleaved
+// per-channel int16 frames) and applies the configured fades in place.
+func (t Trimmer) Trim(samples []int16, startSecs, endSecs float64) []int16 {
+	framesPerSec := t.Format.SampleRate
+	channels := t.Format.Channels
+
+	startFrame := int(startSecs * float64(framesPerSec))
+	endFrame := int(endSecs * float64(framesPerSec))
+
+	totalFrames := len(samples) / channels
+	if startFrame < 0 {
+		startFrame = 0
+	}
+	if endFrame > totalFrames || endFrame <= 0 {
+		endFrame = totalFrames
+	}
+	if startFrame >= endFrame {
+		return []int16{}
+	}
+
+	out := make([]int16, (endFrame-startFrame)*channels)
+	copy(out, samples[startFrame*channels:endFrame*channels])
+
+	t.applyFades(out)
+
+	return out
+}
+
+// applyFades ramps the first FadeInSecs and last FadeOutSecs of out linearly
+// from/to silence, per channel.
+func (t Trimmer) applyFades(out []int16) {
+	channels := t.Format.Channels
+	frames := len(out) / channels
+	if frames == 0 {
+		return
+	}
+
+	fadeInFrames := int(t.FadeInSecs * float64(t.Format.SampleRate))
+	fadeOutFrames := int(t.FadeOutSecs * float64(t.Format.SampleRate))
+	if fadeInFrames > frames {
+		fadeInFrames = frames
+	}
+	if fadeOutFrames > frames {
+		fadeOutFrames = frames
+	}
+
+	for frame := 0; frame < fadeInFrames; frame++ {
+		gain := float64(frame) / float64(fadeInFrames)
+		scaleFrame(out, frame, channels, gain)
+	}
+
+	for i := 0; i < fadeOutFrames; i++ {
+		frame := frames - 1 - i
+		gain := float64(i) / float64(fadeOutFrames)
+		scaleFrame(out, frame, channels, gain)
+	}
+}
+
+func scaleFrame(out []int16, frame, channels int, gain float64) {
+	base := frame * channels
+	for c := 0; c < channels; c++ {
+		out[base+c] = int16(float64(out[base+c]) * gain)
+	}
+}
@@ -0,0 +1,46 @@
+package audio
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/go-audio/wav"
+)
+
+// DecodeWAV reads a RIFF/WAVE file and returns its samples as interleaved
+// int16 frames along with the format it was encoded in, replacing sox as
+// the source of the PCM fed into the render pipeline. go-audio/wav needs
+// an io.ReadSeeker; r is buffered into memory first when it isn't one
+// already (e.g. an S3 or SeaweedFS object body), so any storage.Backend
+// can feed it directly.
+func DecodeWAV(r io.Reader) ([]int16, Format, error) {
+	rs, ok := r.(io.ReadSeeker)
+	if !ok {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, Format{}, err
+		}
+		rs = bytes.NewReader(data)
+	}
+
+	dec := wav.NewDecoder(rs)
+	buf, err := dec.FullPCMBuffer()
+	if err != nil {
+		return nil, Format{}, err
+	}
+
+	format := Format{
+		SampleRate: buf.Format.SampleRate,
+		BitDepth:   int(dec.BitDepth),
+		Channels:   buf.Format.NumChannels,
+		Encoding:   EncodingSignedLE,
+	}
+
+	samples := make([]int16, len(buf.Data))
+	for i, v := range buf.Data {
+		samples[i] = int16(v)
+	}
+
+	return samples, format, nil
+}
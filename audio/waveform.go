@@ -0,0 +1,160 @@
+package audio
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// WaveformColors mirrors the palette previously passed to `audiowaveform`.
+type WaveformColors struct {
+	Background color.RGBA
+	Waveform   color.RGBA
+}
+
+// DefaultWaveformColors matches the --background-color/--waveform-color
+// values the old audiowaveform invocation used.
+var DefaultWaveformColors = WaveformColors{
+	Background: color.RGBA{0x33, 0x33, 0x33, 0xff},
+	Waveform:   color.RGBA{0xed, 0x73, 0x0c, 0xff},
+}
+
+// peakBuckets downsamples samples (interleaved per-channel int16 frames) to
+// width min/max peak pairs, merging all channels, the same min/max-per-pixel
+// reduction `audiowaveform` performs.
+func peakBuckets(samples []int16, channels, width int) (mins, maxes []int16) {
+	frames := len(samples) / channels
+	if frames == 0 || width <= 0 {
+		return nil, nil
+	}
+
+	mins = make([]int16, width)
+	maxes = make([]int16, width)
+
+	framesPerBucket := float64(frames) / float64(width)
+
+	for bucket := 0; bucket < width; bucket++ {
+		start := int(float64(bucket) * framesPerBucket)
+		end := int(float64(bucket+1) * framesPerBucket)
+		if end <= start {
+			end = start + 1
+		}
+		if end > frames {
+			end = frames
+		}
+
+		min, max := int16(0), int16(0)
+		for frame := start; frame < end; frame++ {
+			for c := 0; c < channels; c++ {
+				v := samples[frame*channels+c]
+				if v < min {
+					min = v
+				}
+				if v > max {
+					max = v
+				}
+			}
+		}
+		mins[bucket] = min
+		maxes[bucket] = max
+	}
+
+	return mins, maxes
+}
+
+// RenderWaveformPNG draws a min/max peak waveform of samples to w as a PNG,
+// replacing `audiowaveform --output-filename out.png`.
+func RenderWaveformPNG(w io.Writer, samples []int16, format Format, width, height int) error {
+	return RenderWaveformPNGWithColors(w, samples, format, width, height, DefaultWaveformColors)
+}
+
+// RenderWaveformPNGWithColors is RenderWaveformPNG with an explicit color
+// scheme.
+func RenderWaveformPNGWithColors(w io.Writer, samples []int16, format Format, width, height int, colors WaveformColors) error {
+	mins, maxes := peakBuckets(samples, format.Channels, width)
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, colors.Background)
+		}
+	}
+
+	mid := height / 2
+	for x := 0; x < width && x < len(mins); x++ {
+		yMin := mid - int(float64(maxes[x])/32768.0*float64(mid))
+		yMax := mid - int(float64(mins[x])/32768.0*float64(mid))
+		if yMin > yMax {
+			yMin, yMax = yMax, yMin
+		}
+		for y := yMin; y <= yMax; y++ {
+			if y >= 0 && y < height {
+				img.Set(x, y, colors.Waveform)
+			}
+		}
+	}
+
+	return png.Encode(w, img)
+}
+
+// waveformDatMagic/version match the binary format peaks.js expects from
+// `audiowaveform -z <n> -b 8|16`.
+const (
+	waveformDatMagic   = "wfm "
+	waveformDatVersion = uint32(2)
+)
+
+// WriteWaveformDat writes samples to w as a peaks.js-compatible
+// waveform.dat file: magic, version, flags (1 for 8 bits per sample, else
+// 0), sample rate, samples-per-pixel, length in pixels, then one min/max
+// pair per pixel with all channels merged into it (int8 pairs when
+// bitsPerSample is 8, int16 pairs otherwise), replacing
+// `audiowaveform -o waveform.dat`. No channel count is written.
+func WriteWaveformDat(w io.Writer, samples []int16, format Format, samplesPerPixel, bitsPerSample int) error {
+	frames := len(samples) / format.Channels
+	width := frames / samplesPerPixel
+	if width < 1 {
+		width = 1
+	}
+
+	mins, maxes := peakBuckets(samples, format.Channels, width)
+
+	header := make([]byte, 24)
+	copy(header[0:4], waveformDatMagic)
+	binary.LittleEndian.PutUint32(header[4:8], waveformDatVersion)
+	binary.LittleEndian.PutUint32(header[8:12], boolToUint32(bitsPerSample == 8))
+	binary.LittleEndian.PutUint32(header[12:16], uint32(format.SampleRate))
+	binary.LittleEndian.PutUint32(header[16:20], uint32(samplesPerPixel))
+	binary.LittleEndian.PutUint32(header[20:24], uint32(width))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	for i := 0; i < width; i++ {
+		if bitsPerSample == 8 {
+			if _, err := w.Write([]byte{byte(mins[i] >> 8), byte(maxes[i] >> 8)}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		pair := make([]byte, 4)
+		binary.LittleEndian.PutUint16(pair[0:2], uint16(mins[i]))
+		binary.LittleEndian.PutUint16(pair[2:4], uint16(maxes[i]))
+		if _, err := w.Write(pair); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func boolToUint32(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
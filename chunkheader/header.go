@@ -0,0 +1,198 @@
+// Package chunkheader defines the binary header every uploaded audio
+// chunk is prefixed with, replacing the old `{recorder}_{session}_{chunk}_
+// {timestamp}.raw` filename protocol. The header declares the recorder's
+// actual capture parameters and a monotonic sequence number, so the
+// indexer no longer has to assume a fixed sample rate/depth/channel count
+// and can detect chunks lost in transit.
+package chunkheader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Magic identifies a header-prefixed chunk upload.
+const Magic = "A2FI"
+
+// Version is the current header layout version. Readers should reject
+// any version they don't understand rather than guess at the layout.
+const Version = 1
+
+// Encoding identifies the sample encoding of the chunk payload.
+type Encoding uint8
+
+const (
+	// EncodingSignedLE is signed little-endian integer PCM, the only
+	// encoding the recorders currently produce.
+	EncodingSignedLE Encoding = iota
+)
+
+// Header precedes every chunk payload uploaded to the indexer.
+//
+// Wire layout (all integers little-endian):
+//
+//	4 bytes   magic "A2FI"
+//	1 byte    version
+//	4 bytes   sample rate
+//	1 byte    bit depth
+//	1 byte    channels
+//	1 byte    encoding
+//	2 bytes   recorder ID length, then that many bytes
+//	2 bytes   session ID length, then that many bytes
+//	8 bytes   chunk sequence number
+//	8 bytes   monotonic-ns timestamp
+//	4 bytes   CRC32 of the payload that follows
+type Header struct {
+	SampleRate  uint32
+	BitDepth    uint8
+	Channels    uint8
+	Encoding    Encoding
+	RecorderID  string
+	SessionID   string
+	Sequence    uint64
+	TimestampNS int64
+}
+
+// Encode serializes header followed by payload, computing the payload's
+// CRC32 into the header.
+func Encode(h Header, payload []byte) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString(Magic)
+	buf.WriteByte(Version)
+	writeUint32(&buf, h.SampleRate)
+	buf.WriteByte(h.BitDepth)
+	buf.WriteByte(h.Channels)
+	buf.WriteByte(byte(h.Encoding))
+	writeString16(&buf, h.RecorderID)
+	writeString16(&buf, h.SessionID)
+	writeUint64(&buf, h.Sequence)
+	writeInt64(&buf, h.TimestampNS)
+	writeUint32(&buf, crc32.ChecksumIEEE(payload))
+
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+// Decode parses a header-prefixed chunk, returning the header and the
+// payload it describes. It returns an error if the magic/version don't
+// match or the payload fails its CRC32 check.
+func Decode(data []byte) (Header, []byte, error) {
+	r := bytes.NewReader(data)
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != Magic {
+		return Header{}, nil, fmt.Errorf("chunkheader: not a versioned chunk (bad magic)")
+	}
+
+	version, err := r.ReadByte()
+	if err != nil {
+		return Header{}, nil, err
+	}
+	if version != Version {
+		return Header{}, nil, fmt.Errorf("chunkheader: unsupported version %d", version)
+	}
+
+	var h Header
+	h.SampleRate, err = readUint32(r)
+	if err != nil {
+		return Header{}, nil, err
+	}
+	if h.BitDepth, err = r.ReadByte(); err != nil {
+		return Header{}, nil, err
+	}
+	if h.Channels, err = r.ReadByte(); err != nil {
+		return Header{}, nil, err
+	}
+	encoding, err := r.ReadByte()
+	if err != nil {
+		return Header{}, nil, err
+	}
+	h.Encoding = Encoding(encoding)
+
+	if h.RecorderID, err = readString16(r); err != nil {
+		return Header{}, nil, err
+	}
+	if h.SessionID, err = readString16(r); err != nil {
+		return Header{}, nil, err
+	}
+	if h.Sequence, err = readUint64(r); err != nil {
+		return Header{}, nil, err
+	}
+	if h.TimestampNS, err = readInt64(r); err != nil {
+		return Header{}, nil, err
+	}
+
+	wantCRC, err := readUint32(r)
+	if err != nil {
+		return Header{}, nil, err
+	}
+
+	payload := data[len(data)-r.Len():]
+	if gotCRC := crc32.ChecksumIEEE(payload); gotCRC != wantCRC {
+		return Header{}, nil, fmt.Errorf("chunkheader: payload CRC32 mismatch: got %08x want %08x", gotCRC, wantCRC)
+	}
+
+	return h, payload, nil
+}
+
+func writeUint32(buf *bytes.Buffer, v uint32) {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	buf.Write(b)
+}
+
+func writeUint64(buf *bytes.Buffer, v uint64) {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	buf.Write(b)
+}
+
+func writeInt64(buf *bytes.Buffer, v int64) {
+	writeUint64(buf, uint64(v))
+}
+
+func writeString16(buf *bytes.Buffer, s string) {
+	b := make([]byte, 2)
+	binary.LittleEndian.PutUint16(b, uint16(len(s)))
+	buf.Write(b)
+	buf.WriteString(s)
+}
+
+func readUint32(r *bytes.Reader) (uint32, error) {
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func readUint64(r *bytes.Reader) (uint64, error) {
+	b := make([]byte, 8)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b), nil
+}
+
+func readInt64(r *bytes.Reader) (int64, error) {
+	v, err := readUint64(r)
+	return int64(v), err
+}
+
+func readString16(r *bytes.Reader) (string, error) {
+	b := make([]byte, 2)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	length := binary.LittleEndian.Uint16(b)
+
+	s := make([]byte, length)
+	if _, err := io.ReadFull(r, s); err != nil {
+		return "", err
+	}
+	return string(s), nil
+}
@@ -0,0 +1,57 @@
+package chunkheader
+
+import "testing"
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	h := Header{
+		SampleRate:  48000,
+		BitDepth:    16,
+		Channels:    2,
+		Encoding:    EncodingSignedLE,
+		RecorderID:  "recorder-1",
+		SessionID:   "session-1",
+		Sequence:    42,
+		TimestampNS: 1234567890,
+	}
+	payload := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	data := Encode(h, payload)
+
+	gotHeader, gotPayload, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if gotHeader != h {
+		t.Fatalf("Decode header = %+v, want %+v", gotHeader, h)
+	}
+	if string(gotPayload) != string(payload) {
+		t.Fatalf("Decode payload = %v, want %v", gotPayload, payload)
+	}
+}
+
+func TestDecodeBadMagic(t *testing.T) {
+	data := Encode(Header{}, nil)
+	data[0] = 'X'
+
+	if _, _, err := Decode(data); err == nil {
+		t.Fatal("Decode with corrupted magic: want error, got nil")
+	}
+}
+
+func TestDecodeUnsupportedVersion(t *testing.T) {
+	data := Encode(Header{}, nil)
+	data[4] = Version + 1
+
+	if _, _, err := Decode(data); err == nil {
+		t.Fatal("Decode with unsupported version: want error, got nil")
+	}
+}
+
+func TestDecodeCRCMismatch(t *testing.T) {
+	data := Encode(Header{}, []byte{1, 2, 3})
+	data[len(data)-1] ^= 0xff
+
+	if _, _, err := Decode(data); err == nil {
+		t.Fatal("Decode with corrupted payload: want CRC error, got nil")
+	}
+}
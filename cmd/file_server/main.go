@@ -1,36 +1,72 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"path"
 	"strconv"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
-	"github.com/bogem/id3v2"
-	"github.com/fsnotify/fsnotify"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/pascalhuerst/alsa2fifo_indexer/audio"
+	"github.com/pascalhuerst/alsa2fifo_indexer/jobs"
+	"github.com/pascalhuerst/alsa2fifo_indexer/loudness"
+	"github.com/pascalhuerst/alsa2fifo_indexer/storage"
+	"github.com/pascalhuerst/alsa2fifo_indexer/tags"
 )
 
 const (
 	fadeTime = 0.8
+
+	sessionPrefixRoot   = "sessions"
+	recordingPrefixRoot = "recordings"
+
+	presignValidity = 24 * time.Hour
 )
 
+func sessionPrefix(recorderID, sessionID string) string {
+	return path.Join(sessionPrefixRoot, recorderID, sessionID)
+}
+
+func sessionKey(recorderID, sessionID, name string) string {
+	return path.Join(sessionPrefix(recorderID, sessionID), name)
+}
+
 type fileServer struct {
-	chunkDirPath      string
-	sessionDirPath    string
-	recordingsDirPath string
-	lock              sync.Locker
-	Recorders         map[string]Recorder
-	sessionTTL        time.Duration
-	renderRequestCH   chan RenderRequest
+	backend          storage.Backend
+	recordingsPrefix string
+	lock             sync.Locker
+	Recorders        map[string]Recorder
+	sessionTTL       time.Duration
+	renderRequestCH  chan RenderRequest
+	jobs             *jobs.Queue
+
+	defaultArtist string
+	defaultAlbum  string
+	titleTemplate *template.Template
+}
+
+// tagTemplateContext is what a deployment's -tag-title-template is
+// expanded against, e.g. `{{.RecorderID}} — {{.Segment.Name}} ({{.Date.Format "2006-01-02"}})`.
+type tagTemplateContext struct {
+	RecorderID string
+	SessionID  string
+	Segment    Segment
+	Date       time.Time
 }
 
 // Recorder holds open sessions for a recorder
@@ -44,6 +80,9 @@ type OpenSession struct {
 	WAVFileName      string    `json:"wav_file_name,omitempty"`
 	OGGFileName      string    `json:"ogg_file_name,omitempty"`
 	WaveformFileName string    `json:"waveform_file_name,omitempty"`
+	WAVURL           string    `json:"wav_url,omitempty"`
+	OGGURL           string    `json:"ogg_url,omitempty"`
+	WaveformURL      string    `json:"waveform_url,omitempty"`
 	Timestamp        time.Time `json:"timestamp,omitempty"`
 	HoursToLive      float64   `json:"hours_to_live,omitempty"`
 }
@@ -54,6 +93,21 @@ type Segment struct {
 	StartTime float32  `json:"startTime,omitempty"`
 	EndTime   float32  `json:"endTime,omitempty"`
 	Filetypes []string `json:"filetypes,omitempty"`
+
+	// Per-segment tag overrides. Artist and Album fall back to the
+	// server's defaults and Title to -tag-title-template when left
+	// empty; the other fields have no default.
+	Artist      string            `json:"artist,omitempty"`
+	Title       string            `json:"title,omitempty"`
+	Album       string            `json:"album,omitempty"`
+	TrackNumber int               `json:"trackNumber,omitempty"`
+	Genre       string            `json:"genre,omitempty"`
+	Comment     string            `json:"comment,omitempty"`
+	TXXX        map[string]string `json:"txxx,omitempty"`
+	// ArtworkHash looks artwork up as "artwork/<hash>" on the backend;
+	// ArtworkURL fetches it directly. ArtworkHash wins if both are set.
+	ArtworkHash string `json:"artworkHash,omitempty"`
+	ArtworkURL  string `json:"artworkURL,omitempty"`
 }
 
 // RenderRequest is issues by frontend to session -> recording
@@ -63,205 +117,459 @@ type RenderRequest struct {
 	SessionID  string             `json:"sessionID,omitempty"`
 }
 
+// newBackend builds the storage.Backend sessions and recordings are read
+// from and written to, per the -storage flag. Local disk preserves the
+// on-disk layout previous versions hardcoded (root defaults to "."),
+// while s3 and seaweedfs let the file server scale beyond a single node.
+func newBackend(kind, root, urlPrefix, s3Bucket, filerURL string) (storage.Backend, error) {
+	switch kind {
+	case "local":
+		return storage.NewLocalBackend(root, urlPrefix), nil
+	case "s3":
+		cfg, err := config.LoadDefaultConfig(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("loading AWS config: %w", err)
+		}
+		return storage.NewS3Backend(s3.NewFromConfig(cfg), s3Bucket), nil
+	case "seaweedfs":
+		return storage.NewSeaweedFSBackend(filerURL, root), nil
+	default:
+		return nil, fmt.Errorf("unknown storage kind: %q", kind)
+	}
+}
+
 func main() {
 
-	chunkDir := flag.String("chunk", "chunks", "Directory to look for chunks")
-	sessionDir := flag.String("session", "sessions", "Directory to look for sessions")
-	recordingsDirPath := flag.String("recordings", "recordings", "Directory to store recordings")
+	storageKind := flag.String("storage", "local", "Storage backend: local, s3, or seaweedfs")
+	storageRoot := flag.String("storage-root", ".", "Root directory (local) or key prefix (seaweedfs) sessions/recordings are stored under")
+	storageURLPrefix := flag.String("storage-url-prefix", "http://localhost:8234/files", "URL prefix PresignGet serves local files under")
+	s3Bucket := flag.String("s3-bucket", "", "S3 bucket to store sessions/recordings in (storage=s3)")
+	filerURL := flag.String("filer-url", "http://localhost:8888", "SeaweedFS filer URL (storage=seaweedfs)")
 	sessionTTL := flag.Duration("age", time.Duration(3*24*time.Hour), "Duration to keep sessions, before they are deleted")
+	defaultArtist := flag.String("default-artist", "Paso", "Artist tag used when a segment doesn't set its own")
+	defaultAlbum := flag.String("default-album", "Domestic Affairs Recordings", "Album tag used when a segment doesn't set its own")
+	titleTemplateFlag := flag.String("tag-title-template", "{{.Segment.Name}}", `Go text/template expanded into the Title tag when a segment doesn't set its own, e.g. {{.RecorderID}} - {{.Segment.Name}} ({{.Date.Format "2006-01-02"}})`)
+	jobsDB := flag.String("jobs-db", "jobs.db", "Path to the BoltDB file render jobs are persisted in")
+	jobWorkers := flag.Int("job-workers", 2, "Number of render jobs that may run concurrently")
 	flag.Parse()
 
+	backend, err := newBackend(*storageKind, *storageRoot, *storageURLPrefix, *s3Bucket, *filerURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	titleTemplate, err := template.New("title").Parse(*titleTemplateFlag)
+	if err != nil {
+		log.Fatal(fmt.Errorf("parsing -tag-title-template: %w", err))
+	}
+
+	jobStore, err := jobs.NewStore(*jobsDB)
+	if err != nil {
+		log.Fatal(fmt.Errorf("opening -jobs-db: %w", err))
+	}
+
 	fs := fileServer{
-		chunkDirPath:      *chunkDir,
-		sessionDirPath:    *sessionDir,
-		recordingsDirPath: *recordingsDirPath,
-		lock:              &sync.Mutex{},
-		sessionTTL:        *sessionTTL,
-		renderRequestCH:   make(chan RenderRequest),
+		backend:          backend,
+		recordingsPrefix: recordingPrefixRoot,
+		lock:             &sync.Mutex{},
+		sessionTTL:       *sessionTTL,
+		renderRequestCH:  make(chan RenderRequest),
+		defaultArtist:    *defaultArtist,
+		defaultAlbum:     *defaultAlbum,
+		titleTemplate:    titleTemplate,
+	}
+	fs.jobs = jobs.NewQueue(jobStore, *jobWorkers, fs.runRenderJob)
+
+	// The worker pool must already be draining q.pending before Resume
+	// requeues anything: Resume can requeue more jobs than q.pending's
+	// buffer holds (e.g. a crash mid-batch with many StatusRunning jobs),
+	// and with nothing consuming the channel yet that would block startup
+	// forever.
+	go fs.jobs.Run(context.Background())
+
+	if err := fs.jobs.Resume(); err != nil {
+		log.Fatal(fmt.Errorf("requeuing unfinished jobs: %w", err))
 	}
 
 	fs.parseOpenSessions()
 
-	server := http.FileServer(http.Dir(fs.sessionDirPath))
 	http.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
 		rw.Header().Set("Access-Control-Allow-Origin", "*")
-		server.ServeHTTP(rw, r)
+		fs.serveObject(rw, r)
 	})
 
 	http.HandleFunc("/introspect", fs.introspect)
 	http.HandleFunc("/render", fs.render)
+	http.HandleFunc("/render/validate", fs.renderValidate)
+	http.HandleFunc("/jobs", fs.jobsCollection)
+	http.HandleFunc("/jobs/", fs.jobsItem)
 
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer watcher.Close()
+	changes := make(chan storage.Event)
+	watcher := storage.NewWatcher(fs.backend, sessionPrefixRoot, 5*time.Minute)
+
+	go func() {
+		if err := watcher.Run(context.Background(), changes); err != nil {
+			fmt.Println("watcher error:", err)
+		}
+	}()
 
 	go func() {
 		for {
 			select {
-			case event, ok := <-watcher.Events:
+			case _, ok := <-changes:
 				if !ok {
 					return
 				}
-				if event.Op&fsnotify.Write == fsnotify.Write {
-					fs.parseOpenSessions()
-				}
-			case err, ok := <-watcher.Errors:
-				if !ok {
-					return
-				}
-				fmt.Println("error:", err)
-			case <-time.After(time.Minute * 5):
-				fmt.Println("Checking sessions directory")
 				fs.parseOpenSessions()
-				fmt.Println("Checking sessions directory - Done.")
 			case request := <-fs.renderRequestCH:
 				fmt.Printf("RenderRequest: %v\n", request)
-				fs.renderRequest(request)
+				if _, err := fs.jobs.Enqueue(request.RecorderID, request.SessionID, request); err != nil {
+					fmt.Printf("Cannot enqueue render job: %v\n", err)
+				}
 			}
 		}
 	}()
 
-	err = watcher.Add(fs.sessionDirPath)
+	http.ListenAndServe(":8234", nil)
+}
+
+// serveObject replaces the old http.FileServer(http.Dir(sessionDirPath))
+// static serving: it reads the requested key straight off the backend,
+// which keeps /<recorder>/<session>/<file> working unchanged for local
+// disk while still functioning against S3/SeaweedFS.
+func (f fileServer) serveObject(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	if key == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	rc, err := f.backend.Get(r.Context(), path.Join(sessionPrefixRoot, key))
+	if err == storage.ErrNotExist {
+		http.NotFound(w, r)
+		return
+	}
 	if err != nil {
-		log.Fatal(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	defer rc.Close()
 
-	http.ListenAndServe(":8234", nil)
+	io.Copy(w, rc)
 }
 
-func (f fileServer) renderRequest(r RenderRequest) error {
+// renderWorkItem is one segment/filetype combination a RenderRequest
+// expands into; each becomes one rendered file.
+type renderWorkItem struct {
+	name          string
+	fileExtension string
+	segment       Segment
+}
+
+// runRenderJob is the jobs.Handler that backs every render: it is the
+// old renderRequest, now driven by a *jobs.Queue worker instead of a
+// goroutine-per-request, so progress is reported and a crash mid-render
+// leaves a StatusRunning job Resume can pick back up.
+func (f fileServer) runRenderJob(ctx context.Context, job *jobs.Job, report jobs.Reporter) error {
+	var r RenderRequest
+	if err := json.Unmarshal(job.Payload, &r); err != nil {
+		return fmt.Errorf("decoding render job payload: %w", err)
+	}
 
-	sourceFilePathRel := filepath.Join(f.sessionDirPath, r.RecorderID, r.SessionID, "data.wav")
-	sourceFilePath, err := filepath.Abs(sourceFilePathRel)
+	rc, err := f.backend.Get(ctx, sessionKey(r.RecorderID, r.SessionID, "data.wav"))
 	if err != nil {
-		fmt.Printf("Cannot get absolute path: %v\n", err)
-		return fmt.Errorf("Cannot get absolute path: %v", err)
+		return fmt.Errorf("cannot open source file: %w", err)
+	}
+	samples, format, err := audio.DecodeWAV(rc)
+	rc.Close()
+	if err != nil {
+		return fmt.Errorf("cannot decode source file: %w", err)
 	}
 
-	createAudioFile := func(name, fileExtension string, startTime, endTime float32) {
-		targetAudioFilePathRel := filepath.Join(f.recordingsDirPath, fmt.Sprintf("domestic_affairs_%s.%s", name, fileExtension))
-		targetAudioFilePath, err := filepath.Abs(targetAudioFilePathRel)
-		if err != nil {
-			fmt.Printf("Cannot get absolute path: %v\n", err)
-			return
+	pipeline := audio.NewPipeline(format, fadeTime)
+
+	var items []renderWorkItem
+	for _, value := range r.Segments {
+		for _, filetype := range value.Filetypes {
+			items = append(items, renderWorkItem{
+				name:          strings.ReplaceAll(value.Name, " ", "_"),
+				fileExtension: filetype,
+				segment:       value,
+			})
 		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
 
-		strFadeTime := fmt.Sprintf("%.1f", fadeTime)
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		completed int
+	)
+
+	for _, item := range items {
+		item := item
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if ctx.Err() == nil {
+				if err := f.createAudioFile(ctx, r, samples, format, pipeline, item); err != nil {
+					report.Log(fmt.Sprintf("%s.%s: %v", item.name, item.fileExtension, err))
+				}
+			}
 
-		soxCmd := exec.Command("/usr/bin/sox", sourceFilePath, targetAudioFilePath, "trim", fmt.Sprintf("%v", startTime), fmt.Sprintf("=%v", endTime), "fade", strFadeTime, "-0", strFadeTime, "norm", "-0.1")
-		fmt.Printf("Create: %s\n", targetAudioFilePathRel)
+			mu.Lock()
+			completed++
+			progress := float64(completed) / float64(len(items))
+			mu.Unlock()
+			report.SetProgress(progress)
+		}()
+	}
+	wg.Wait()
 
-		err = soxCmd.Start()
-		if err != nil {
-			fmt.Printf("Cannot create %s file: %v\n", fileExtension, err)
-			return
-		}
+	return ctx.Err()
+}
 
-		err = soxCmd.Wait()
-		if err != nil {
-			fmt.Printf("Cannot create %s file: %v\n", fileExtension, err)
-			return
-		}
-		fmt.Printf("Create: %s - Done.\n", targetAudioFilePathRel)
-		fmt.Printf("Write ID3 Tag: %s\n", targetAudioFilePathRel)
+// createAudioFile trims, loudness-normalizes, tags and uploads the
+// recording for one segment/filetype combination of a render job.
+func (f fileServer) createAudioFile(ctx context.Context, r RenderRequest, samples []int16, format audio.Format, pipeline *audio.Pipeline, item renderWorkItem) error {
+	targetKey := path.Join(f.recordingsPrefix, fmt.Sprintf("domestic_affairs_%s.%s", item.name, item.fileExtension))
 
-		tag, err := id3v2.Open(targetAudioFilePath, id3v2.Options{Parse: true})
-		if err != nil {
-			fmt.Printf("Cannot write ID3 Tag: %v\n", err)
-			return
-		}
-		defer tag.Close()
+	fmt.Printf("Create: %s\n", targetKey)
 
-		tag.SetArtist("Paso")
-		tag.SetTitle("DA#13")
-		tag.SetYear(fmt.Sprintf("%d", time.Now().Year()))
-		tag.SetAlbum("Domestic Affairs Recordings")
+	tagSet, err := f.resolveTags(r, item.segment)
+	if err != nil {
+		return fmt.Errorf("resolving tags: %w", err)
+	}
 
-		artwork, err := ioutil.ReadFile("logo_black.png")
-		if err != nil {
-			fmt.Printf("Cannot read artwork: %v\n", err)
+	segment := pipeline.Trimmer.Trim(samples, float64(item.segment.StartTime), float64(item.segment.EndTime))
+	measured, err := loudness.NormalizeToTarget(segment, format, loudness.DefaultTarget)
+	if err != nil {
+		return fmt.Errorf("loudness-normalizing: %w", err)
+	}
+
+	if tagSet.Custom == nil {
+		tagSet.Custom = make(map[string]string, 3)
+	}
+	tagSet.Custom["REPLAYGAIN_TRACK_GAIN"] = fmt.Sprintf("%.2f dB", loudness.DefaultTarget.LUFS-measured.IntegratedLUFS)
+	tagSet.Custom["REPLAYGAIN_TRACK_PEAK"] = fmt.Sprintf("%.6f", dbtpToLinear(measured.TruePeakDBTP))
+	tagSet.Custom["REPLAYGAIN_REFERENCE_LOUDNESS"] = fmt.Sprintf("%.1f LUFS", loudness.DefaultTarget.LUFS)
+
+	var enc audio.Encoder
+	switch item.fileExtension {
+	case "wav":
+		enc = audio.WAVEncoder{}
+	case "ogg":
+		enc = audio.OGGEncoder{Comments: tagSet.VorbisComments()}
+	default:
+		return fmt.Errorf("no encoder for extension %q", item.fileExtension)
+	}
+
+	tmp, err := ioutil.TempFile("", "alsa2fifo-render-*."+item.fileExtension)
+	if err != nil {
+		return fmt.Errorf("creating %s file: %w", item.fileExtension, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := enc.Encode(tmp, segment, format); err != nil {
+		tmp.Close()
+		return fmt.Errorf("encoding %s file: %w", item.fileExtension, err)
+	}
+	fmt.Printf("Create: %s - Done.\n", targetKey)
+
+	// Ogg/Opus carries its Vorbis Comments in the stream itself
+	// (written above); only ID3v2 formats need a post-encode pass.
+	if item.fileExtension == "wav" {
+		fmt.Printf("Write ID3 Tag: %s\n", targetKey)
+		artwork := f.resolveArtwork(ctx, tagSet)
+		if err := tags.WriteID3v2(tmp.Name(), tagSet, artwork); err != nil {
+			tmp.Close()
+			return fmt.Errorf("writing ID3 tag: %w", err)
 		}
+		fmt.Printf("Write ID3 Tag: %s - Done.\n", targetKey)
+	}
+
+	tmp.Seek(0, io.SeekStart)
+	err = f.backend.Put(ctx, targetKey, tmp)
+	tmp.Close()
+	if err != nil {
+		return fmt.Errorf("storing %s: %w", item.fileExtension, err)
+	}
+
+	return nil
+}
 
-		pic := id3v2.PictureFrame{
-			Encoding:    id3v2.EncodingUTF8,
-			MimeType:    "image/png",
-			PictureType: id3v2.PTFrontCover,
-			Description: "Front cover",
-			Picture:     artwork,
+// resolveTags expands a segment's metadata into the TagSet it's rendered
+// with, falling back to the server's defaults (Artist, Album) or
+// -tag-title-template (Title) for anything the segment left unset.
+func (f fileServer) resolveTags(r RenderRequest, segment Segment) (tags.TagSet, error) {
+	title := segment.Title
+	if title == "" {
+		ctx := tagTemplateContext{
+			RecorderID: r.RecorderID,
+			SessionID:  r.SessionID,
+			Segment:    segment,
+			Date:       time.Now(),
 		}
-		tag.AddAttachedPicture(pic)
-		// Write tag to file.
-		if err = tag.Save(); err != nil {
-			fmt.Printf("Cannot write ID3 Tag: %v\n", err)
-			return
+		var buf bytes.Buffer
+		if err := f.titleTemplate.Execute(&buf, ctx); err != nil {
+			return tags.TagSet{}, fmt.Errorf("expanding -tag-title-template: %w", err)
 		}
+		title = buf.String()
+	}
 
-		fmt.Printf("Write ID3 Tag: %s - Done.\n", targetAudioFilePathRel)
+	artist := segment.Artist
+	if artist == "" {
+		artist = f.defaultArtist
+	}
+	album := segment.Album
+	if album == "" {
+		album = f.defaultAlbum
 	}
 
-	for _, value := range r.Segments {
-		for _, filetype := range value.Filetypes {
-			fixedName := strings.ReplaceAll(value.Name, " ", "_")
+	custom := make(map[string]string, len(segment.TXXX))
+	for k, v := range segment.TXXX {
+		custom[k] = v
+	}
 
-			go createAudioFile(fixedName, filetype, value.StartTime, value.EndTime)
+	return tags.TagSet{
+		Artist:      artist,
+		Title:       title,
+		Album:       album,
+		Genre:       segment.Genre,
+		Comment:     segment.Comment,
+		TrackNumber: segment.TrackNumber,
+		Custom:      custom,
+		ArtworkURL:  segment.ArtworkURL,
+		ArtworkHash: segment.ArtworkHash,
+	}, nil
+}
+
+// resolveArtwork loads the front-cover image a segment references: by
+// content-hash on the backend first, then by URL, falling back to the
+// bundled default artwork if neither is set or reachable.
+func (f fileServer) resolveArtwork(ctx context.Context, t tags.TagSet) []byte {
+	if t.ArtworkHash != "" {
+		rc, err := f.backend.Get(ctx, path.Join("artwork", t.ArtworkHash))
+		if err == nil {
+			defer rc.Close()
+			if data, err := ioutil.ReadAll(rc); err == nil {
+				return data
+			}
+		} else {
+			fmt.Printf("Cannot load artwork %s: %v\n", t.ArtworkHash, err)
 		}
 	}
 
-	return nil
+	if t.ArtworkURL != "" {
+		resp, err := http.Get(t.ArtworkURL)
+		if err == nil {
+			defer resp.Body.Close()
+			if data, err := ioutil.ReadAll(resp.Body); err == nil {
+				return data
+			}
+		} else {
+			fmt.Printf("Cannot fetch artwork %s: %v\n", t.ArtworkURL, err)
+		}
+	}
+
+	artwork, err := ioutil.ReadFile("logo_black.png")
+	if err != nil {
+		fmt.Printf("Cannot read artwork: %v\n", err)
+		return nil
+	}
+	return artwork
 }
 
-func (f *fileServer) parseOpenSessions() error {
+// renderValidate resolves the tag set every segment/filetype combination
+// in a RenderRequest would be rendered with, without encoding or storing
+// anything - a pre-flight so a frontend can show the final metadata
+// before committing to a render.
+func (f fileServer) renderValidate(w http.ResponseWriter, r *http.Request) {
 
-	ret := make(map[string]Recorder, 1)
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
 
-	recorders, err := ioutil.ReadDir(f.sessionDirPath)
-	if err != nil {
-		return fmt.Errorf("Cannot read recorders in: %v", f.sessionDirPath)
+	if r.Method != "POST" {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
 	}
 
-	newSessions := []OpenSession{}
+	renderRequest := RenderRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&renderRequest); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	for _, recorder := range recorders {
-		sessionsPath := filepath.Join(f.sessionDirPath, recorder.Name())
-		ss, err := ioutil.ReadDir(sessionsPath)
+	resolved := make(map[string]tags.TagSet, len(renderRequest.Segments))
+	for key, segment := range renderRequest.Segments {
+		tagSet, err := f.resolveTags(renderRequest, segment)
 		if err != nil {
-			return fmt.Errorf("Cannot read sessions in: %v", sessionsPath)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
+		resolved[key] = tagSet
+	}
 
-		for _, s := range ss {
-			epoche, err := strconv.ParseInt(s.Name(), 10, 64)
-			if err != nil {
-				return fmt.Errorf("Cannot parse epoche: %s", s.Name())
-			}
+	js, err := json.MarshalIndent(resolved, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(js)
+}
 
-			toLive := f.sessionTTL - time.Duration(time.Now().Sub(time.Unix(0, epoche)))
-			fmt.Printf("Session [%s] has %f hours left, before it gets deleted\n", s.Name(), toLive.Hours())
+// parseOpenSessions lists every open session the backend currently holds
+// under "sessions/", deletes any past f.sessionTTL, and refreshes
+// f.Recorders for introspect. This is the backend-driven replacement for
+// the previous ioutil.ReadDir(f.sessionDirPath) walk.
+func (f *fileServer) parseOpenSessions() error {
+	ctx := context.Background()
 
-			if toLive.Hours() < 0 {
-				toDelete := filepath.Join(f.sessionDirPath, recorder.Name(), s.Name())
-				fmt.Printf("Attempting to delete: %s\n", toDelete)
-				err = os.RemoveAll(toDelete)
-				if err != nil {
-					fmt.Printf("Cannot remove folder: %v\n", err)
-				}
-				continue
-			}
+	objects, err := f.backend.List(ctx, sessionPrefixRoot)
+	if err != nil {
+		return fmt.Errorf("Cannot list sessions: %v", err)
+	}
 
-			session := OpenSession{
-				ID:               s.Name(),
-				OGGFileName:      "data.ogg",
-				WAVFileName:      "data.wav",
-				WaveformFileName: "waveform.dat",
-				Timestamp:        time.Unix(0, epoche),
-				HoursToLive:      toLive.Hours(),
+	ret := make(map[string]Recorder, 1)
+
+	for _, pair := range recorderSessionPairs(objects) {
+		recorderID, sessionID := pair[0], pair[1]
+
+		epoche, err := strconv.ParseInt(sessionID, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Cannot parse epoche: %s", sessionID)
+		}
+
+		toLive := f.sessionTTL - time.Since(time.Unix(0, epoche))
+		fmt.Printf("Session [%s] has %f hours left, before it gets deleted\n", sessionID, toLive.Hours())
+
+		if toLive.Hours() < 0 {
+			fmt.Printf("Attempting to delete: %s\n", sessionPrefix(recorderID, sessionID))
+			if err := f.backend.Delete(ctx, sessionPrefix(recorderID, sessionID)); err != nil {
+				fmt.Printf("Cannot remove session: %v\n", err)
 			}
-			newSessions = append(newSessions, session)
+			continue
 		}
-		ret[recorder.Name()] = Recorder{
-			OpenSessions: newSessions,
+
+		session := OpenSession{
+			ID:               sessionID,
+			OGGFileName:      "data.ogg",
+			WAVFileName:      "data.wav",
+			WaveformFileName: "waveform.dat",
+			Timestamp:        time.Unix(0, epoche),
+			HoursToLive:      toLive.Hours(),
 		}
+		session.WAVURL, _ = f.backend.PresignGet(ctx, sessionKey(recorderID, sessionID, session.WAVFileName), presignValidity)
+		session.OGGURL, _ = f.backend.PresignGet(ctx, sessionKey(recorderID, sessionID, session.OGGFileName), presignValidity)
+		session.WaveformURL, _ = f.backend.PresignGet(ctx, sessionKey(recorderID, sessionID, session.WaveformFileName), presignValidity)
+
+		recorder := ret[recorderID]
+		recorder.OpenSessions = append(recorder.OpenSessions, session)
+		ret[recorderID] = recorder
 	}
 
 	f.lock.Lock()
@@ -271,6 +579,30 @@ func (f *fileServer) parseOpenSessions() error {
 	return nil
 }
 
+// recorderSessionPairs returns the distinct recorder/session pairs found
+// among session keys, i.e. the two path segments following
+// sessionPrefixRoot.
+func recorderSessionPairs(objects []storage.ObjectInfo) [][2]string {
+	seen := make(map[[2]string]bool)
+	var pairs [][2]string
+
+	for _, obj := range objects {
+		rel := strings.TrimPrefix(obj.Key, sessionPrefixRoot+"/")
+		parts := strings.SplitN(rel, "/", 3)
+		if len(parts) < 2 {
+			continue
+		}
+
+		pair := [2]string{parts[0], parts[1]}
+		if !seen[pair] {
+			seen[pair] = true
+			pairs = append(pairs, pair)
+		}
+	}
+
+	return pairs
+}
+
 func (f fileServer) introspect(w http.ResponseWriter, r *http.Request) {
 
 	f.lock.Lock()
@@ -307,3 +639,141 @@ func (f fileServer) render(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("Success"))
 
 }
+
+// jobsCollection serves POST /jobs (enqueue a RenderRequest, returning its
+// job ID) and GET /jobs (list jobs, optionally filtered by ?recorderID=
+// and/or ?sessionID=).
+func (f fileServer) jobsCollection(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "POST":
+		renderRequest := RenderRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&renderRequest); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		job, err := f.jobs.Enqueue(renderRequest.RecorderID, renderRequest.SessionID, renderRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(job)
+	case "GET":
+		list, err := f.jobs.List(r.URL.Query().Get("recorderID"), r.URL.Query().Get("sessionID"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(list)
+	default:
+		http.Error(w, "GET or POST required", http.StatusMethodNotAllowed)
+	}
+}
+
+// jobsItem serves GET /jobs/{id} (status), DELETE /jobs/{id} (cancel) and
+// GET /jobs/{id}/events (SSE progress stream).
+func (f fileServer) jobsItem(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/jobs/")
+
+	if id := strings.TrimSuffix(rest, "/events"); id != rest {
+		f.jobEvents(w, r, id)
+		return
+	}
+	id := rest
+
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		job, err := f.jobs.Get(id)
+		if err == jobs.ErrNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(job)
+	case "DELETE":
+		if err := f.jobs.Cancel(id); err == jobs.ErrNotFound {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"status":"canceled"}`))
+	default:
+		http.Error(w, "GET or DELETE required", http.StatusMethodNotAllowed)
+	}
+}
+
+// jobEvents streams a job's status/progress as Server-Sent Events until
+// the job reaches a terminal state or the client disconnects.
+func (f fileServer) jobEvents(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	job, err := f.jobs.Get(id)
+	if err == jobs.ErrNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	events, unsubscribe := f.jobs.Subscribe(id)
+	defer unsubscribe()
+
+	writeEvent := func(j jobs.Job) bool {
+		js, err := json.Marshal(j)
+		if err != nil {
+			return false
+		}
+		fmt.Fprintf(w, "data: %s\n\n", js)
+		flusher.Flush()
+		return j.Status == jobs.StatusDone || j.Status == jobs.StatusFailed || j.Status == jobs.StatusCanceled
+	}
+
+	if writeEvent(*job) {
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case j, ok := <-events:
+			if !ok {
+				return
+			}
+			if writeEvent(j) {
+				return
+			}
+		}
+	}
+}
+
+// dbtpToLinear converts a dBTP true-peak measurement to the linear scale
+// REPLAYGAIN_TRACK_PEAK is conventionally stored in.
+func dbtpToLinear(dbtp float64) float64 {
+	return math.Pow(10, dbtp/20)
+}
@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"mime/multipart"
 	"net/http"
@@ -14,12 +15,32 @@ import (
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+
+	"github.com/pascalhuerst/alsa2fifo_indexer/chunkheader"
 )
 
+// format describes the capture parameters this recorder writes, prepended
+// to every upload as a chunkheader.Header so the indexer no longer has to
+// assume a fixed sample rate/depth/channel count.
+var format struct {
+	sampleRate int
+	bitDepth   int
+	channels   int
+	recorderID string
+}
+
+// sequences tracks the next expected chunk sequence number per session,
+// so the indexer can detect chunks lost in transit.
+var sequences = map[string]uint64{}
+
 func main() {
 	fmt.Println("Hello! Indexer!...")
 
 	watchDir := flag.String("dir", "", "Directory to watch for changes")
+	sampleRate := flag.Int("rate", 48000, "Sample rate of the captured audio")
+	bitDepth := flag.Int("depth", 16, "Bit depth of the captured audio")
+	channels := flag.Int("channels", 2, "Channel count of the captured audio")
+	recorderID := flag.String("recorder", "", "Recorder ID to stamp into the chunk header (defaults to the hostname)")
 	flag.Parse()
 
 	if *watchDir == "" {
@@ -27,6 +48,18 @@ func main() {
 		return
 	}
 
+	format.sampleRate = *sampleRate
+	format.bitDepth = *bitDepth
+	format.channels = *channels
+	format.recorderID = *recorderID
+	if format.recorderID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Fatal(err)
+		}
+		format.recorderID = hostname
+	}
+
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		log.Fatal(err)
@@ -45,21 +78,12 @@ func main() {
 				if event.Op&fsnotify.Write == fsnotify.Write {
 					log.Println("modified file:", event.Name)
 
-					tokens := strings.Split(event.Name, "_")
-					tokens = strings.Split(tokens[len(tokens)-1], ".")
-					epoche, err := strconv.ParseInt(tokens[0], 10, 64)
-					if err != nil {
-						log.Fatal(err)
-					}
-
-					fmt.Println(time.Unix(0, epoche))
-
-					tokens = strings.Split(event.Name, "/")
+					tokens := strings.Split(event.Name, "/")
 					fileName := tokens[len(tokens)-1]
 
 					Upload(event.Name, fileName)
 
-					os.Remove(fileName)
+					os.Remove(event.Name)
 
 				}
 			case err, ok := <-watcher.Errors:
@@ -78,13 +102,54 @@ func main() {
 	<-done
 }
 
+// parseSessionAndTimestamp extracts the session ID and capture timestamp
+// out of a `{session}_{timestamp}.raw` file name.
+func parseSessionAndTimestamp(fileName string) (sessionID string, timestampNS int64, err error) {
+	tokens := strings.Split(fileName, "_")
+	if len(tokens) < 2 {
+		return "", 0, fmt.Errorf("cannot parse file name: %s", fileName)
+	}
+
+	sessionID = tokens[0]
+
+	last := strings.Split(tokens[len(tokens)-1], ".")
+	timestampNS, err = strconv.ParseInt(last[0], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("cannot parse timestamp in %s: %v", fileName, err)
+	}
+
+	return sessionID, timestampNS, nil
+}
+
+// Upload prepends a versioned chunk header to the raw PCM at path and
+// POSTs it to the indexer, replacing the plain filename-encoded protocol.
 func Upload(path, fileName string) {
+	sessionID, timestampNS, err := parseSessionAndTimestamp(fileName)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	fmt.Println(time.Unix(0, timestampNS))
 
-	file, err := os.Open(path)
+	payload, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Fatalln(err)
+		log.Println(err)
+		return
 	}
-	defer file.Close()
+
+	sequence := sequences[sessionID]
+	sequences[sessionID] = sequence + 1
+
+	chunk := chunkheader.Encode(chunkheader.Header{
+		SampleRate:  uint32(format.sampleRate),
+		BitDepth:    uint8(format.bitDepth),
+		Channels:    uint8(format.channels),
+		Encoding:    chunkheader.EncodingSignedLE,
+		RecorderID:  format.recorderID,
+		SessionID:   sessionID,
+		Sequence:    sequence,
+		TimestampNS: timestampNS,
+	}, payload)
 
 	var requestBody bytes.Buffer
 	multiPartWriter := multipart.NewWriter(&requestBody)
@@ -94,7 +159,7 @@ func Upload(path, fileName string) {
 		log.Println(err)
 	}
 
-	_, err = io.Copy(fileWriter, file)
+	_, err = io.Copy(fileWriter, bytes.NewReader(chunk))
 	if err != nil {
 		log.Println(err)
 	}
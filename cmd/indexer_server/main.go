@@ -1,216 +1,339 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/pascalhuerst/alsa2fifo_indexer/audio"
+	"github.com/pascalhuerst/alsa2fifo_indexer/chunkheader"
+	"github.com/pascalhuerst/alsa2fifo_indexer/session"
+	"github.com/pascalhuerst/alsa2fifo_indexer/storage"
+	"github.com/pascalhuerst/alsa2fifo_indexer/stream"
 )
 
+// waveformSamplesPerPixel matches the pixel density the former
+// `audiowaveform -z 256` invocation produced for waveform.dat.
+const waveformSamplesPerPixel = 256
+
+// chunkPrefixRoot and sessionPrefixRoot root the two key namespaces stored on the
+// indexer's storage.Backend: in-progress chunks, and the merged sessions
+// they're closed into.
+const (
+	chunkPrefixRoot   = "chunks"
+	sessionPrefixRoot = "sessions"
+)
+
+func chunkPrefix(recorderID, sessionID string) string {
+	return path.Join(chunkPrefixRoot, recorderID, sessionID)
+}
+
+func chunkKey(recorderID, sessionID string, sequence uint64) string {
+	return path.Join(chunkPrefix(recorderID, sessionID), chunkFileName(sequence))
+}
+
+func sessionPrefix(recorderID, sessionID string) string {
+	return path.Join(sessionPrefixRoot, recorderID, sessionID)
+}
+
+func sessionKey(recorderID, sessionID, name string) string {
+	return path.Join(sessionPrefix(recorderID, sessionID), name)
+}
+
+func writeWaveformImage(samples []int16, format audio.Format, width, height int) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
+	if err := audio.RenderWaveformPNG(&buf, samples, format, width, height); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+func writeWaveformData(samples []int16, format audio.Format) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
+	if err := audio.WriteWaveformDat(&buf, samples, format, waveformSamplesPerPixel, 8); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
 type indexer struct {
-	chunkDir           string
-	sessionDir         string
+	backend            storage.Backend
 	sessionForRecorder map[string]string
+	live               *stream.Server
+
+	manifestLock sync.Locker
+	manifests    map[string]*session.Manifest
 }
 
-type chunk struct {
-	recorderID string
-	sessionID  string
-	chunkID    string
-	timestamp  string
+func manifestKey(recorderID, sessionID string) string {
+	return recorderID + "/" + sessionID
 }
 
-func parseFileName(fileName string) (chunk, error) {
+// chunkFileName names a stored chunk payload by its sequence number, so
+// closeSession can read chunks back in order and detect gaps, regardless
+// of upload arrival order.
+func chunkFileName(sequence uint64) string {
+	return fmt.Sprintf("%020d.raw", sequence)
+}
+
+func chunkSequenceFromFileName(name string) (uint64, error) {
+	trimmed := strings.TrimSuffix(name, ".raw")
+	return strconv.ParseUint(trimmed, 10, 64)
+}
 
-	tokens := strings.Split(fileName, "_")
-	if len(tokens) != 4 {
-		return chunk{}, fmt.Errorf("Cannot parse file name: %s", fileName)
+// recorderSessionPairs returns the distinct recorder/session pairs found
+// among chunk keys, i.e. the two path segments following chunkPrefixRoot.
+func recorderSessionPairs(objects []storage.ObjectInfo) [][2]string {
+	seen := make(map[[2]string]bool)
+	var pairs [][2]string
+
+	for _, obj := range objects {
+		rel := strings.TrimPrefix(obj.Key, chunkPrefixRoot+"/")
+		parts := strings.SplitN(rel, "/", 3)
+		if len(parts) < 2 {
+			continue
+		}
+
+		pair := [2]string{parts[0], parts[1]}
+		if !seen[pair] {
+			seen[pair] = true
+			pairs = append(pairs, pair)
+		}
 	}
 
-	return chunk{
-		recorderID: tokens[0],
-		sessionID:  tokens[1],
-		chunkID:    tokens[2],
-		timestamp:  strings.Replace(tokens[3], ".raw", "", -1),
-	}, nil
+	return pairs
 }
 
 func (i indexer) cleanupChunks() {
+	ctx := context.Background()
 
-	recorders, err := ioutil.ReadDir(i.chunkDir)
+	objects, err := i.backend.List(ctx, chunkPrefixRoot)
 	if err != nil {
-		fmt.Printf("Cannot read recorders in: %v\n", i.chunkDir)
+		fmt.Printf("Cannot list chunks: %v\n", err)
 		return
 	}
 
-	for _, recorder := range recorders {
-		fmt.Printf("Cleaning up %s\n", recorder.Name())
+	for _, pair := range recorderSessionPairs(objects) {
+		fmt.Printf(" Closing session: %s/%s\n", pair[0], pair[1])
+		i.closeSession(pair[0], pair[1])
+	}
+}
 
-		sessionsPath := filepath.Join(i.chunkDir, recorder.Name())
-		sessions, err := ioutil.ReadDir(sessionsPath)
-		if err != nil {
-			fmt.Printf("Cannot read sessions in: %v\n", sessionsPath)
-			return
-		}
+func (i indexer) loadManifest(recorderID, sessionID string) *session.Manifest {
+	ctx := context.Background()
 
-		for _, session := range sessions {
-			fmt.Printf(" Closing session: %s\n", recorder.Name())
-			i.closeSession(recorder.Name(), session.Name())
-		}
+	defaultManifest := &session.Manifest{
+		RecorderID: recorderID,
+		SessionID:  sessionID,
+		SampleRate: uint32(audio.DefaultFormat.SampleRate),
+		BitDepth:   uint8(audio.DefaultFormat.BitDepth),
+		Channels:   uint8(audio.DefaultFormat.Channels),
 	}
-}
 
-func (i indexer) closeSession(recorderID, sessionID string) {
+	r, err := i.backend.Get(ctx, path.Join(chunkPrefix(recorderID, sessionID), session.ManifestFileName))
+	if err != nil {
+		fmt.Printf("Cannot load session manifest, assuming default format: %v\n", err)
+		return defaultManifest
+	}
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		fmt.Printf("Cannot read session manifest, assuming default format: %v\n", err)
+		return defaultManifest
+	}
 
-	targetPath := filepath.Join(i.sessionDir, recorderID, sessionID)
-	os.MkdirAll(targetPath, os.ModePerm)
+	var manifest session.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		fmt.Printf("Cannot decode session manifest, assuming default format: %v\n", err)
+		return defaultManifest
+	}
+	return &manifest
+}
 
-	sourcePath := filepath.Join(i.chunkDir, recorderID, sessionID)
-	chunks, err := ioutil.ReadDir(sourcePath)
+func (i indexer) saveManifest(key string, manifest *session.Manifest) error {
+	js, err := json.MarshalIndent(manifest, "", "  ")
 	if err != nil {
-		fmt.Printf("Cannot read chunks in: %v\n", sourcePath)
-		return
+		return err
 	}
+	return i.backend.Put(context.Background(), key, bytes.NewReader(js))
+}
 
-	targetRawFilePath := filepath.Join(targetPath, "data.raw")
-	targetFile, err := os.Create(targetRawFilePath)
+// closeSession merges the chunks collected for recorderID/sessionID into
+// a session recording, filling any gap in the stored chunks' sequence
+// numbers with silence (each missing chunk as long as the chunk before
+// it), and stores the session's manifest, whose gaps and damaged flag
+// were recorded as chunks arrived, next to the recording so the frontend
+// can surface that to the user.
+func (i indexer) closeSession(recorderID, sessionID string) {
+	ctx := context.Background()
+	sourcePrefix := chunkPrefix(recorderID, sessionID)
+
+	chunkFiles, err := i.backend.List(ctx, sourcePrefix)
 	if err != nil {
-		fmt.Printf("Cannot create target file: %v\n", targetFile)
+		fmt.Printf("Cannot list chunks in: %v\n", sourcePrefix)
 		return
 	}
-	defer targetFile.Close()
+	sort.Slice(chunkFiles, func(a, b int) bool { return chunkFiles[a].Key < chunkFiles[b].Key })
+
+	manifest := i.loadManifest(recorderID, sessionID)
+	format := audio.Format{
+		SampleRate: int(manifest.SampleRate),
+		BitDepth:   int(manifest.BitDepth),
+		Channels:   int(manifest.Channels),
+		Encoding:   audio.EncodingSignedLE,
+	}
 
-	nSamples := 0
+	var merged bytes.Buffer
+	var lastSeq uint64
+	haveLastSeq := false
+	var lastChunkLen int
 
-	for _, chunk := range chunks {
-		chunkFilePath := filepath.Join(sourcePath, chunk.Name())
-		d, err := ioutil.ReadFile(chunkFilePath)
-		if err != nil {
-			fmt.Printf("Cannot read file: %v\n", chunkFilePath)
-			return
+	for _, chunkFile := range chunkFiles {
+		name := path.Base(chunkFile.Key)
+		if name == session.ManifestFileName {
+			continue
 		}
 
-		n, err := targetFile.Write(d)
+		seq, err := chunkSequenceFromFileName(name)
 		if err != nil {
-			fmt.Printf("Cannot write chunk to target file: %v\n", targetFile)
-			return
+			fmt.Printf("Skipping unrecognized chunk file: %v\n", name)
+			continue
 		}
-		nSamples += n
-	}
 
-	err = os.RemoveAll(sourcePath)
-	if err != nil {
-		fmt.Printf("Cannot remove source directoy: %v\n", sourcePath)
-		return
-	}
+		if haveLastSeq && seq > lastSeq+1 && lastChunkLen > 0 {
+			missing := int(seq - lastSeq - 1)
+			fmt.Printf("Filling %d missing chunk(s) after sequence %d with silence\n", missing, lastSeq)
+			merged.Write(make([]byte, missing*lastChunkLen))
+		}
 
-	createAudioFile := func(fileExtension string) {
-		targetAudioFilePath := filepath.Join(targetPath, fmt.Sprintf("data.%s", fileExtension))
-		soxCmd := exec.Command("/usr/bin/sox", "-r", "48000", "-b", "16", "-c", "2", "--endian=little", "--encoding=signed-integer", targetRawFilePath, targetAudioFilePath)
-		err = soxCmd.Start()
+		r, err := i.backend.Get(ctx, chunkFile.Key)
 		if err != nil {
-			fmt.Printf("Cannot create wav file: %v\n", err)
+			fmt.Printf("Cannot read chunk: %v\n", chunkFile.Key)
 			return
 		}
-		err = soxCmd.Wait()
+		n, err := io.Copy(&merged, r)
+		r.Close()
 		if err != nil {
-			fmt.Printf("Cannot create wav file: %v\n", err)
+			fmt.Printf("Cannot read chunk: %v\n", chunkFile.Key)
 			return
 		}
 
+		lastSeq = seq
+		haveLastSeq = true
+		lastChunkLen = int(n)
 	}
 
-	createAudioFile("wav")
-	createAudioFile("ogg")
+	if err := i.backend.Delete(ctx, sourcePrefix); err != nil {
+		fmt.Printf("Cannot remove source chunks: %v\n", sourcePrefix)
+		return
+	}
 
-	err = os.Remove(targetRawFilePath)
+	if err := i.saveManifest(sessionKey(recorderID, sessionID, session.ManifestFileName), manifest); err != nil {
+		fmt.Printf("Cannot save session manifest: %v\n", err)
+	}
+
+	samples, err := audio.ReadSamples(bytes.NewReader(merged.Bytes()), format)
 	if err != nil {
-		fmt.Printf("Cannot remove raw audio file: %v\n", err)
+		fmt.Printf("Cannot decode raw audio: %v\n", err)
 		return
 	}
 
-	createWaveform := func(inFile, outFile string, zoom, width, height int) error {
-
-		const (
-			// --background-color
-			backgroundColor = "333333"
-			// --waveform-color
-			waveformColor = "ed730c"
-			// --axis-label-color
-			fontColor = "222222"
-			// --border-color
-			borderColor = "222222"
-		)
-
-		//strZoom := fmt.Sprintf("%d", zoom)
-		strWidth := fmt.Sprintf("%d", width)
-		strHeight := fmt.Sprintf("%d", height)
-		cmd := exec.Command("audiowaveform", "--input-filename", inFile, "--output-filename", outFile, "--zoom", "auto", "--width", strWidth, "--height", strHeight)
-		stderr, err := cmd.StderrPipe()
-		if err != nil {
-			return err
-		}
-		err = cmd.Start()
+	pipeline := audio.NewPipeline(format, 0)
+	for _, extension := range []string{"wav", "ogg"} {
+		enc, _ := pipeline.EncoderByExtension(extension)
+
+		tmp, err := ioutil.TempFile("", "alsa2fifo-session-*."+extension)
 		if err != nil {
-			errorBuffer, _ := ioutil.ReadAll(stderr)
-			return fmt.Errorf("%s", string(errorBuffer))
+			fmt.Printf("Cannot create temp file for %s: %v\n", extension, err)
+			return
 		}
 
-		err = cmd.Wait()
-		if err != nil {
-			return err
+		if err := enc.Encode(tmp, samples, format); err != nil {
+			tmp.Close()
+			fmt.Printf("Cannot encode %s: %v\n", extension, err)
+			return
 		}
+		tmp.Seek(0, io.SeekStart)
 
-		return nil
+		if err := i.backend.Put(ctx, sessionKey(recorderID, sessionID, "data."+extension), tmp); err != nil {
+			fmt.Printf("Cannot store %s: %v\n", extension, err)
+		}
+		tmp.Close()
+		os.Remove(tmp.Name())
 	}
 
-	waveformSourceFile := filepath.Join(targetPath, "data.wav")
-	targetOverviewWaveformImagePath, err := filepath.Abs(filepath.Join(targetPath, "overview.png"))
-	if err != nil {
-		fmt.Printf("Cannot get absolute path: %v\n", err)
-		return
+	overview, err := writeWaveformImage(samples, format, 1000, 200)
+	if err == nil {
+		err = i.backend.Put(ctx, sessionKey(recorderID, sessionID, "overview.png"), overview)
 	}
-	err = createWaveform(waveformSourceFile, targetOverviewWaveformImagePath, 300, 1000, 200)
 	if err != nil {
 		fmt.Printf("Cannot create waveform file: %v\n", err)
 		return
 	}
 
-	targetFullWaveformImagePath, err := filepath.Abs(filepath.Join(targetPath, "full.png"))
-	if err != nil {
-		fmt.Printf("Cannot get absolute path: %v\n", err)
-		return
+	full, err := writeWaveformImage(samples, format, 10000, 200)
+	if err == nil {
+		err = i.backend.Put(ctx, sessionKey(recorderID, sessionID, "full.png"), full)
 	}
-	err = createWaveform(waveformSourceFile, targetFullWaveformImagePath, 300, 10000, 200)
 	if err != nil {
 		fmt.Printf("Cannot create waveform file: %v\n", err)
 		return
 	}
 
-	targetFullWaveformDataPath, err := filepath.Abs(filepath.Join(targetPath, "waveform.dat"))
-	if err != nil {
-		fmt.Printf("Cannot get absolute path: %v\n", err)
-		return
+	dat, err := writeWaveformData(samples, format)
+	if err == nil {
+		err = i.backend.Put(ctx, sessionKey(recorderID, sessionID, "waveform.dat"), dat)
 	}
-	//TODO:  audiowaveform --input-filename=./data.wav --output-filename=waveform.dat -z 256 -b 8
-	err = createWaveform(waveformSourceFile, targetFullWaveformDataPath, 300, 10000, 200)
 	if err != nil {
 		fmt.Printf("Cannot create waveform file: %v\n", err)
 		return
 	}
 
+	i.manifestLock.Lock()
+	delete(i.manifests, manifestKey(recorderID, sessionID))
+	i.manifestLock.Unlock()
+
 	fmt.Printf("Successfully closed session: %s\n", sessionID)
 }
 
+// manifestFor returns the in-memory manifest tracking recorderID/sessionID,
+// starting a fresh one from h if this is the first chunk seen for that
+// session.
+func (i indexer) manifestFor(h chunkheader.Header) *session.Manifest {
+	key := manifestKey(h.RecorderID, h.SessionID)
+
+	i.manifestLock.Lock()
+	defer i.manifestLock.Unlock()
+
+	if m, ok := i.manifests[key]; ok {
+		return m
+	}
+
+	m := session.NewManifest(h)
+	i.manifests[key] = m
+	return m
+}
+
 func (i indexer) uploadFile(w http.ResponseWriter, r *http.Request) {
 
 	r.ParseMultipartForm(1024 * 1024 * 10)
-	file, handler, err := r.FormFile("raw_audio")
+	file, _, err := r.FormFile("raw_audio")
 	if err != nil {
 		fmt.Println("Error Retrieving the File")
 		fmt.Println(err)
@@ -224,66 +347,109 @@ func (i indexer) uploadFile(w http.ResponseWriter, r *http.Request) {
 		fmt.Println(err)
 	}
 
-	chk, err := parseFileName(handler.Filename)
+	header, payload, err := chunkheader.Decode(fileBytes)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
 		fmt.Println(err)
 		return
 	}
 
-	if sessionID, ok := i.sessionForRecorder[chk.recorderID]; !ok {
-		i.sessionForRecorder[chk.recorderID] = chk.sessionID
+	manifest := i.manifestFor(header)
+	if manifest.SampleRate != header.SampleRate || manifest.BitDepth != header.BitDepth || manifest.Channels != header.Channels {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Printf("Chunk declares mismatched session parameters: recorder=%s session=%s\n", header.RecorderID, header.SessionID)
+		return
+	}
+	manifest.Observe(header.Sequence)
+
+	if sessionID, ok := i.sessionForRecorder[header.RecorderID]; !ok {
+		i.sessionForRecorder[header.RecorderID] = header.SessionID
 	} else {
-		if sessionID != chk.sessionID {
+		if sessionID != header.SessionID {
 			fmt.Printf("Closing session: %s\n", sessionID)
-			go i.closeSession(chk.recorderID, sessionID)
+			go i.closeSession(header.RecorderID, sessionID)
 		}
-		i.sessionForRecorder[chk.recorderID] = chk.sessionID
+		i.sessionForRecorder[header.RecorderID] = header.SessionID
 	}
 
-	targetPath := filepath.Join(i.chunkDir, chk.recorderID, chk.sessionID)
-	os.MkdirAll(targetPath, os.ModePerm)
-	targetFilePath := filepath.Join(targetPath, fmt.Sprintf("%s_%s.raw", chk.chunkID, chk.timestamp))
-
-	err = ioutil.WriteFile(targetFilePath, fileBytes, 0664)
-	if err != nil {
+	ctx := r.Context()
+	if err := i.backend.Put(ctx, chunkKey(header.RecorderID, header.SessionID, header.Sequence), bytes.NewReader(payload)); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Println(err)
 		return
 	}
 
-	fmt.Printf("[%s] [%v]: session=%s chunk=%s\n", chk.recorderID, time.Now().Format("2006-01-02 15:04:05"), chk.sessionID, chk.chunkID)
+	if err := i.saveManifest(path.Join(chunkPrefix(header.RecorderID, header.SessionID), session.ManifestFileName), manifest); err != nil {
+		fmt.Printf("Cannot save session manifest: %v\n", err)
+	}
+
+	format := audio.Format{
+		SampleRate: int(header.SampleRate),
+		BitDepth:   int(header.BitDepth),
+		Channels:   int(header.Channels),
+		Encoding:   audio.EncodingSignedLE,
+	}
+	if samples, err := audio.ReadSamples(bytes.NewReader(payload), format); err != nil {
+		fmt.Printf("Cannot decode chunk for live stream: %v\n", err)
+	} else {
+		i.live.Publish(header.RecorderID, samples)
+	}
+
+	fmt.Printf("[%s] [%v]: session=%s chunk=%d\n", header.RecorderID, time.Now().Format("2006-01-02 15:04:05"), header.SessionID, header.Sequence)
 	w.WriteHeader(http.StatusOK)
 }
 
 func (i indexer) setupRoutes() {
 	http.HandleFunc("/upload", i.uploadFile)
+	i.live.RegisterRoutes(http.DefaultServeMux)
 	http.ListenAndServe(":8080", nil)
 }
 
+// newBackend builds the storage.Backend the indexer stores chunks and
+// sessions on, per the -storage flag. Local disk preserves the on-disk
+// layout previous versions hardcoded (root defaults to "."), while s3 and
+// seaweedfs let the indexer scale beyond a single node.
+func newBackend(kind, root, urlPrefix, s3Bucket, filerURL string) (storage.Backend, error) {
+	switch kind {
+	case "local":
+		return storage.NewLocalBackend(root, urlPrefix), nil
+	case "s3":
+		cfg, err := config.LoadDefaultConfig(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("loading AWS config: %w", err)
+		}
+		return storage.NewS3Backend(s3.NewFromConfig(cfg), s3Bucket), nil
+	case "seaweedfs":
+		return storage.NewSeaweedFSBackend(filerURL, root), nil
+	default:
+		return nil, fmt.Errorf("unknown storage kind: %q", kind)
+	}
+}
+
 func main() {
 
-	chunkDir := flag.String("chunk", "chunks", "Directory to store chunks")
-	sessionDir := flag.String("session", "sessions", "Directory to store sessions")
+	storageKind := flag.String("storage", "local", "Storage backend: local, s3, or seaweedfs")
+	storageRoot := flag.String("storage-root", ".", "Root directory (local) or key prefix (seaweedfs) chunks/sessions are stored under")
+	storageURLPrefix := flag.String("storage-url-prefix", "http://localhost:8080/files", "URL prefix PresignGet serves local files under")
+	s3Bucket := flag.String("s3-bucket", "", "S3 bucket to store chunks/sessions in (storage=s3)")
+	filerURL := flag.String("filer-url", "http://localhost:8888", "SeaweedFS filer URL (storage=seaweedfs)")
 	flag.Parse()
 
-	i := indexer{
-		sessionForRecorder: make(map[string]string),
-	}
-
-	err := os.MkdirAll(*chunkDir, os.ModePerm)
+	backend, err := newBackend(*storageKind, *storageRoot, *storageURLPrefix, *s3Bucket, *filerURL)
 	if err != nil {
-		fmt.Printf("Cannot create directory: %s\n", *chunkDir)
+		fmt.Printf("Cannot create storage backend: %v\n", err)
 		return
 	}
-	i.chunkDir = *chunkDir
 
-	err = os.MkdirAll(*sessionDir, 0773)
-	if err != nil {
-		fmt.Printf("Cannot create directory: %s\n", *sessionDir)
-		return
+	i := indexer{
+		backend:            backend,
+		sessionForRecorder: make(map[string]string),
+		manifestLock:       &sync.Mutex{},
+		manifests:          make(map[string]*session.Manifest),
+		live: stream.NewServer(audio.DefaultFormat.SampleRate, audio.DefaultFormat.Channels, func() stream.Encoder {
+			return stream.PassthroughEncoder{}
+		}),
 	}
-	i.sessionDir = *sessionDir
 
 	fmt.Printf("Cleaning up old chunks...\n")
 	i.cleanupChunks()
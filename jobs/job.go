@@ -0,0 +1,61 @@
+// Package jobs persists render jobs in an embedded BoltDB store so
+// /render survives a server restart: each job's status and progress are
+// durable, in-flight jobs are resumable, and callers can poll or stream
+// progress instead of firing a goroutine into the void.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Status is where a Job currently stands in its lifecycle.
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	StatusRunning Status = "running"
+	StatusDone    Status = "done"
+	StatusFailed  Status = "failed"
+	// StatusCanceled is reached via Queue.Cancel, either before a job
+	// started running or by canceling its context mid-run.
+	StatusCanceled Status = "canceled"
+)
+
+// ErrNotFound is returned by Store.Get and Queue.Get when no job exists
+// for the given ID.
+var ErrNotFound = errors.New("jobs: job not found")
+
+// Job is one persisted unit of render work. Payload is opaque to this
+// package - it is whatever the Handler a Queue was built with expects,
+// round-tripped through JSON so it survives a restart.
+type Job struct {
+	ID         string          `json:"id"`
+	RecorderID string          `json:"recorderID,omitempty"`
+	SessionID  string          `json:"sessionID,omitempty"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+
+	Status   Status   `json:"status"`
+	Progress float64  `json:"progress"`
+	Error    string   `json:"error,omitempty"`
+	Log      []string `json:"log,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Handler runs one job's payload. Implementations report progress via
+// report as they go; returning an error marks the job StatusFailed with
+// that error's text, ctx.Err() marks it StatusCanceled.
+type Handler func(ctx context.Context, job *Job, report Reporter) error
+
+// Reporter lets a Handler publish progress and log lines as it works
+// through a job, without reaching into the Queue's internals.
+type Reporter interface {
+	// SetProgress updates the job's completion fraction, 0 to 1.
+	SetProgress(fraction float64)
+	// Log appends a line to the job's log.
+	Log(line string)
+}
@@ -0,0 +1,298 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Queue runs persisted Jobs through a fixed-size worker pool, replacing
+// an unbounded goroutine per request. Every state change is written
+// through to the Store before being fanned out to subscribers, so GET
+// /jobs/{id} and the SSE stream never disagree.
+type Queue struct {
+	store   *Store
+	handler Handler
+	workers int
+	pending chan string
+
+	cancelsMu sync.Mutex
+	cancels   map[string]context.CancelFunc
+
+	subsMu sync.Mutex
+	subs   map[string][]chan Job
+
+	seq uint64
+}
+
+// NewQueue builds a Queue backed by store, running jobs through handler
+// with up to workers running concurrently. Call Run to start the worker
+// pool and Resume to requeue anything left running from a previous
+// process.
+func NewQueue(store *Store, workers int, handler Handler) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &Queue{
+		store:   store,
+		handler: handler,
+		workers: workers,
+		pending: make(chan string, 64),
+		cancels: make(map[string]context.CancelFunc),
+		subs:    make(map[string][]chan Job),
+	}
+}
+
+// Run starts the worker pool; it blocks until ctx is canceled.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (q *Queue) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-q.pending:
+			q.run(ctx, id)
+		}
+	}
+}
+
+func (q *Queue) run(parent context.Context, id string) {
+	job, err := q.store.Get(id)
+	if err != nil {
+		fmt.Printf("jobs: cannot load queued job %s: %v\n", id, err)
+		return
+	}
+	if job.Status == StatusCanceled {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	q.cancelsMu.Lock()
+	q.cancels[id] = cancel
+	q.cancelsMu.Unlock()
+	defer func() {
+		cancel()
+		q.cancelsMu.Lock()
+		delete(q.cancels, id)
+		q.cancelsMu.Unlock()
+	}()
+
+	job.Status = StatusRunning
+	q.save(job)
+
+	err = q.handler(ctx, job, reporter{q: q, job: job, mu: &sync.Mutex{}})
+
+	switch {
+	case ctx.Err() != nil:
+		job.Status = StatusCanceled
+	case err != nil:
+		job.Status = StatusFailed
+		job.Error = err.Error()
+	default:
+		job.Status = StatusDone
+		job.Progress = 1
+	}
+	q.save(job)
+}
+
+// Enqueue persists a new pending Job wrapping payload and schedules it
+// to run. recorderID/sessionID are denormalized onto the Job so List can
+// filter without unmarshaling every payload.
+func (q *Queue) Enqueue(recorderID, sessionID string, payload interface{}) (*Job, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	job := &Job{
+		ID:         fmt.Sprintf("%d-%d", now.UnixNano(), atomic.AddUint64(&q.seq, 1)),
+		RecorderID: recorderID,
+		SessionID:  sessionID,
+		Payload:    raw,
+		Status:     StatusPending,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	if err := q.store.Put(job); err != nil {
+		return nil, err
+	}
+
+	q.pending <- job.ID
+
+	return job, nil
+}
+
+// Resume re-queues every job the store still has marked StatusRunning,
+// which can only mean the previous process died mid-render.
+func (q *Queue) Resume() error {
+	all, err := q.store.List()
+	if err != nil {
+		return err
+	}
+
+	for _, job := range all {
+		if job.Status != StatusRunning {
+			continue
+		}
+		job.Status = StatusPending
+		if err := q.store.Put(job); err != nil {
+			return err
+		}
+		q.pending <- job.ID
+	}
+
+	return nil
+}
+
+// Get returns the current state of one job.
+func (q *Queue) Get(id string) (*Job, error) {
+	return q.store.Get(id)
+}
+
+// List returns every job whose RecorderID/SessionID match the given
+// filters, which are ignored when empty.
+func (q *Queue) List(recorderID, sessionID string) ([]*Job, error) {
+	all, err := q.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	if recorderID == "" && sessionID == "" {
+		return all, nil
+	}
+
+	filtered := all[:0]
+	for _, job := range all {
+		if recorderID != "" && job.RecorderID != recorderID {
+			continue
+		}
+		if sessionID != "" && job.SessionID != sessionID {
+			continue
+		}
+		filtered = append(filtered, job)
+	}
+
+	return filtered, nil
+}
+
+// Cancel stops a running job's context, or marks a still-pending one
+// canceled directly so its worker skips it once dequeued.
+func (q *Queue) Cancel(id string) error {
+	q.cancelsMu.Lock()
+	cancel, running := q.cancels[id]
+	q.cancelsMu.Unlock()
+
+	if running {
+		cancel()
+		return nil
+	}
+
+	job, err := q.store.Get(id)
+	if err != nil {
+		return err
+	}
+	if job.Status != StatusPending {
+		return nil
+	}
+
+	job.Status = StatusCanceled
+	job.UpdatedAt = time.Now()
+	if err := q.store.Put(job); err != nil {
+		return err
+	}
+	q.publish(job)
+	return nil
+}
+
+// Subscribe returns a channel of job snapshots as they change, and an
+// unsubscribe func the caller must call when done (e.g. when its SSE
+// client disconnects).
+func (q *Queue) Subscribe(id string) (<-chan Job, func()) {
+	ch := make(chan Job, 8)
+
+	q.subsMu.Lock()
+	q.subs[id] = append(q.subs[id], ch)
+	q.subsMu.Unlock()
+
+	unsubscribe := func() {
+		q.subsMu.Lock()
+		defer q.subsMu.Unlock()
+
+		subs := q.subs[id]
+		for i, c := range subs {
+			if c == ch {
+				q.subs[id] = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+		close(ch)
+	}
+
+	return ch, unsubscribe
+}
+
+func (q *Queue) save(job *Job) {
+	job.UpdatedAt = time.Now()
+	if err := q.store.Put(job); err != nil {
+		fmt.Printf("jobs: cannot persist job %s: %v\n", job.ID, err)
+	}
+	q.publish(job)
+}
+
+func (q *Queue) publish(job *Job) {
+	q.subsMu.Lock()
+	defer q.subsMu.Unlock()
+
+	for _, ch := range q.subs[job.ID] {
+		select {
+		case ch <- *job:
+		default:
+		}
+	}
+}
+
+// reporter is the Reporter a running job's Handler sees; it funnels
+// progress/log updates back through the owning Queue so they are
+// persisted and published the same way status changes are. mu is shared
+// across every copy of a given run's reporter (runRenderJob-style
+// Handlers fan a job out across goroutines, all reporting through the
+// same value) so concurrent SetProgress/Log calls don't race on job's
+// fields.
+type reporter struct {
+	q   *Queue
+	job *Job
+	mu  *sync.Mutex
+}
+
+func (r reporter) SetProgress(fraction float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.job.Progress = fraction
+	r.q.save(r.job)
+}
+
+func (r reporter) Log(line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.job.Log = append(r.job.Log, line)
+	r.q.save(r.job)
+}
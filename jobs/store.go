@@ -0,0 +1,96 @@
+package jobs
+
+import (
+	"encoding/json"
+
+	"go.etcd.io/bbolt"
+)
+
+var jobsBucket = []byte("jobs")
+
+// Store persists Jobs in a single-file BoltDB database, keyed by Job.ID.
+type Store struct {
+	db *bbolt.DB
+}
+
+// NewStore opens (creating if necessary) the BoltDB file at path and
+// ensures its jobs bucket exists.
+func NewStore(path string) (*Store, error) {
+	db, err := bbolt.Open(path, 0664, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(jobsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Close closes the underlying BoltDB file.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Put writes job, overwriting any previous record with the same ID.
+func (s *Store) Put(job *Job) error {
+	js, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(jobsBucket).Put([]byte(job.ID), js)
+	})
+}
+
+// Get reads back the job stored under id, or ErrNotFound.
+func (s *Store) Get(id string) (*Job, error) {
+	var job Job
+	found := false
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(jobsBucket).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &job)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+
+	return &job, nil
+}
+
+// List returns every persisted job, in no particular order. Callers
+// filter the result for recorder/session or status as needed.
+func (s *Store) List() ([]*Job, error) {
+	var jobs []*Job
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(_, data []byte) error {
+			var job Job
+			if err := json.Unmarshal(data, &job); err != nil {
+				return err
+			}
+			jobs = append(jobs, &job)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
@@ -0,0 +1,158 @@
+package loudness
+
+import (
+	"math"
+	"sort"
+
+	"github.com/pascalhuerst/alsa2fifo_indexer/audio"
+)
+
+const (
+	gatingBlockSeconds   = 0.4
+	gatingOverlap        = 0.75
+	absoluteGateLUFS     = -70.0
+	relativeGateOffsetLU = -10.0
+
+	lraBlockSeconds     = 3.0
+	lraOverlap          = 2.0 / 3.0
+	lraAbsoluteGate     = -70.0
+	lraRelativeOffsetLU = -20.0
+	lraLowPercentile    = 0.10
+	lraHighPercentile   = 0.95
+)
+
+// blockMeanSquares computes, for each gating block of blockSeconds with the
+// given overlap fraction, the BS.1770 channel-weighted mean square energy
+// (the un-logarithmed "z" value of the spec).
+func blockMeanSquares(weighted [][]float64, format audio.Format, blockSeconds, overlap float64) []float64 {
+	if len(weighted) == 0 || len(weighted[0]) == 0 {
+		return nil
+	}
+
+	blockFrames := int(blockSeconds * float64(format.SampleRate))
+	hopFrames := int(float64(blockFrames) * (1 - overlap))
+	if hopFrames < 1 {
+		hopFrames = 1
+	}
+
+	frames := len(weighted[0])
+	var blocks []float64
+
+	for start := 0; start+blockFrames <= frames; start += hopFrames {
+		var z float64
+		for c, channel := range weighted {
+			var sumSquares float64
+			for _, s := range channel[start : start+blockFrames] {
+				sumSquares += s * s
+			}
+			meanSquare := sumSquares / float64(blockFrames)
+			z += channelWeight(c) * meanSquare
+		}
+		blocks = append(blocks, z)
+	}
+
+	return blocks
+}
+
+func zToLUFS(z float64) float64 {
+	if z <= 0 {
+		return math.Inf(-1)
+	}
+	return -0.691 + 10*math.Log10(z)
+}
+
+// integratedLoudness implements the BS.1770-4 two-stage gating algorithm:
+// an absolute gate at -70 LUFS, then a relative gate 10 LU below the mean
+// of the blocks that passed the absolute gate.
+func integratedLoudness(weighted [][]float64, format audio.Format) float64 {
+	blocks := blockMeanSquares(weighted, format, gatingBlockSeconds, gatingOverlap)
+	if len(blocks) == 0 {
+		return math.Inf(-1)
+	}
+
+	var passedAbsolute []float64
+	for _, z := range blocks {
+		if zToLUFS(z) > absoluteGateLUFS {
+			passedAbsolute = append(passedAbsolute, z)
+		}
+	}
+	if len(passedAbsolute) == 0 {
+		return math.Inf(-1)
+	}
+
+	relativeThreshold := zToLUFS(mean(passedAbsolute)) + relativeGateOffsetLU
+
+	var passedRelative []float64
+	for _, z := range passedAbsolute {
+		if zToLUFS(z) > relativeThreshold {
+			passedRelative = append(passedRelative, z)
+		}
+	}
+	if len(passedRelative) == 0 {
+		return math.Inf(-1)
+	}
+
+	return zToLUFS(mean(passedRelative))
+}
+
+// loudnessRange implements the EBU R128/3342 loudness range: short-term
+// (3s) loudness is gated at an absolute -70 LUFS and a relative threshold
+// 20 LU below the gated mean, then LRA is the 95th minus 10th percentile
+// of the remaining distribution.
+func loudnessRange(weighted [][]float64, format audio.Format) float64 {
+	blocks := blockMeanSquares(weighted, format, lraBlockSeconds, lraOverlap)
+	if len(blocks) == 0 {
+		return 0
+	}
+
+	loudnesses := make([]float64, 0, len(blocks))
+	for _, z := range blocks {
+		l := zToLUFS(z)
+		if l > lraAbsoluteGate {
+			loudnesses = append(loudnesses, l)
+		}
+	}
+	if len(loudnesses) == 0 {
+		return 0
+	}
+
+	relativeThreshold := mean(loudnesses) + lraRelativeOffsetLU
+	gated := loudnesses[:0]
+	for _, l := range loudnesses {
+		if l > relativeThreshold {
+			gated = append(gated, l)
+		}
+	}
+	if len(gated) == 0 {
+		return 0
+	}
+
+	sort.Float64s(gated)
+	low := percentile(gated, lraLowPercentile)
+	high := percentile(gated, lraHighPercentile)
+	return high - low
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// percentile returns the value at fraction p (0..1) of sorted, using
+// linear interpolation between the two nearest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := p * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+	frac := rank - float64(lower)
+	return sorted[lower]*(1-frac) + sorted[upper]*frac
+}
@@ -0,0 +1,73 @@
+package loudness
+
+import "github.com/pascalhuerst/alsa2fifo_indexer/audio"
+
+// biquad is a direct-form-II transposed IIR biquad, used for the two
+// K-weighting stages defined by BS.1770-4.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (b *biquad) process(x float64) float64 {
+	y := b.b0*x + b.z1
+	b.z1 = b.b1*x - b.a1*y + b.z2
+	b.z2 = b.b2*x - b.a2*y
+	return y
+}
+
+// highShelfStage is the 1681 Hz, +4 dB high-shelf pre-filter, with
+// coefficients specified by BS.1770-4 at a 48 kHz sample rate.
+func highShelfStage() biquad {
+	return biquad{
+		b0: 1.53512485958697,
+		b1: -2.69169618940638,
+		b2: 1.19839281085285,
+		a1: -1.69065929318241,
+		a2: 0.73248077421585,
+	}
+}
+
+// highPassStage is the 38 Hz high-pass (RLB weighting) stage, with
+// coefficients specified by BS.1770-4 at a 48 kHz sample rate.
+func highPassStage() biquad {
+	return biquad{
+		b0: 1.0,
+		b1: -2.0,
+		b2: 1.0,
+		a1: -1.99004745483398,
+		a2: 0.99007225036621,
+	}
+}
+
+// kWeighted applies the two-stage K-weighting filter to every channel of
+// samples independently and returns the result as per-channel float64
+// sample streams. Samples are scaled to [-1, 1) before filtering; the
+// filtered values can fall outside that range.
+func kWeighted(samples []int16, format audio.Format) [][]float64 {
+	channels := format.Channels
+	frames := len(samples) / channels
+
+	out := make([][]float64, channels)
+	for c := 0; c < channels; c++ {
+		out[c] = make([]float64, frames)
+	}
+
+	shelves := make([]biquad, channels)
+	passes := make([]biquad, channels)
+	for c := 0; c < channels; c++ {
+		shelves[c] = highShelfStage()
+		passes[c] = highPassStage()
+	}
+
+	for frame := 0; frame < frames; frame++ {
+		for c := 0; c < channels; c++ {
+			x := float64(samples[frame*channels+c]) / 32768.0
+			x = shelves[c].process(x)
+			x = passes[c].process(x)
+			out[c][frame] = x
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,52 @@
+// Package loudness implements ITU-R BS.1770-4 integrated loudness, EBU
+// R128 loudness range and true-peak measurement, replacing the peak-only
+// `sox norm -0.1` normalization previously applied to rendered segments.
+package loudness
+
+import (
+	"io"
+
+	"github.com/pascalhuerst/alsa2fifo_indexer/audio"
+)
+
+// Result holds the measurements needed to gain-adjust a recording to a
+// loudness target and to populate ReplayGain-style tags.
+type Result struct {
+	IntegratedLUFS  float64
+	LoudnessRangeLU float64
+	TruePeakDBTP    float64
+}
+
+// channelWeight returns the BS.1770 channel weighting: 1.0 for the first
+// two (L/R) channels, 1.41 for any additional (surround) channels.
+func channelWeight(channel int) float64 {
+	if channel < 2 {
+		return 1.0
+	}
+	return 1.41
+}
+
+// Analyze measures the integrated loudness, loudness range and true peak
+// of the PCM stream read from r, which must be encoded per format.
+func Analyze(r io.Reader, format audio.Format) (Result, error) {
+	samples, err := audio.ReadSamples(r, format)
+	if err != nil {
+		return Result{}, err
+	}
+	return AnalyzeSamples(samples, format), nil
+}
+
+// AnalyzeSamples is Analyze for samples already decoded into memory.
+func AnalyzeSamples(samples []int16, format audio.Format) Result {
+	weighted := kWeighted(samples, format)
+
+	integrated := integratedLoudness(weighted, format)
+	lra := loudnessRange(weighted, format)
+	truePeak := estimateTruePeakDBTP(samples, format)
+
+	return Result{
+		IntegratedLUFS:  integrated,
+		LoudnessRangeLU: lra,
+		TruePeakDBTP:    truePeak,
+	}
+}
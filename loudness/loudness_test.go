@@ -0,0 +1,118 @@
+package loudness
+
+import (
+	"math"
+	"testing"
+
+	"github.com/pascalhuerst/alsa2fifo_indexer/audio"
+)
+
+func TestMean(t *testing.T) {
+	got := mean([]float64{1, 2, 3, 4})
+	if want := 2.5; got != want {
+		t.Fatalf("mean = %v, want %v", got, want)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5}
+
+	if got, want := percentile(sorted, 0), 1.0; got != want {
+		t.Errorf("percentile(0) = %v, want %v", got, want)
+	}
+	if got, want := percentile(sorted, 1), 5.0; got != want {
+		t.Errorf("percentile(1) = %v, want %v", got, want)
+	}
+	if got, want := percentile(sorted, 0.5), 3.0; got != want {
+		t.Errorf("percentile(0.5) = %v, want %v", got, want)
+	}
+}
+
+func TestZToLUFS(t *testing.T) {
+	if got := zToLUFS(0); !math.IsInf(got, -1) {
+		t.Errorf("zToLUFS(0) = %v, want -Inf", got)
+	}
+	if got := zToLUFS(1); got != -0.691 {
+		t.Errorf("zToLUFS(1) = %v, want -0.691", got)
+	}
+}
+
+func TestAnalyzeSamplesSilence(t *testing.T) {
+	format := audio.Format{SampleRate: 48000, BitDepth: 16, Channels: 2, Encoding: audio.EncodingSignedLE}
+	samples := make([]int16, format.Channels*format.SampleRate) // 1s of silence
+
+	result := AnalyzeSamples(samples, format)
+
+	if !math.IsInf(result.IntegratedLUFS, -1) {
+		t.Errorf("IntegratedLUFS = %v, want -Inf", result.IntegratedLUFS)
+	}
+	if result.LoudnessRangeLU != 0 {
+		t.Errorf("LoudnessRangeLU = %v, want 0", result.LoudnessRangeLU)
+	}
+	if !math.IsInf(result.TruePeakDBTP, -1) {
+		t.Errorf("TruePeakDBTP = %v, want -Inf", result.TruePeakDBTP)
+	}
+}
+
+func TestAnalyzeSamplesFullScale(t *testing.T) {
+	format := audio.Format{SampleRate: 48000, BitDepth: 16, Channels: 1, Encoding: audio.EncodingSignedLE}
+	samples := make([]int16, format.SampleRate)
+	for i := range samples {
+		samples[i] = math.MaxInt16
+	}
+
+	result := AnalyzeSamples(samples, format)
+
+	if result.TruePeakDBTP < -0.5 || result.TruePeakDBTP > 0.5 {
+		t.Errorf("TruePeakDBTP = %v, want close to 0 dBTP for a full-scale signal", result.TruePeakDBTP)
+	}
+}
+
+func TestNormalizeToTargetAppliesGain(t *testing.T) {
+	format := audio.Format{SampleRate: 48000, BitDepth: 16, Channels: 1, Encoding: audio.EncodingSignedLE}
+
+	samples := make([]int16, format.SampleRate)
+	for i := range samples {
+		if i%2 == 0 {
+			samples[i] = 3000
+		} else {
+			samples[i] = -3000
+		}
+	}
+
+	target := Target{LUFS: -16.0, TruePeakDBTP: -1.0}
+	result, err := NormalizeToTarget(samples, format, target)
+	if err != nil {
+		t.Fatalf("NormalizeToTarget: %v", err)
+	}
+
+	if result.TruePeakDBTP > target.TruePeakDBTP+0.01 {
+		t.Errorf("TruePeakDBTP = %v, want <= %v", result.TruePeakDBTP, target.TruePeakDBTP)
+	}
+
+	reanalyzed := AnalyzeSamples(samples, format)
+	if math.Abs(reanalyzed.IntegratedLUFS-result.IntegratedLUFS) > 0.01 {
+		t.Errorf("returned Result.IntegratedLUFS = %v does not match re-measured %v", result.IntegratedLUFS, reanalyzed.IntegratedLUFS)
+	}
+	if math.Abs(reanalyzed.TruePeakDBTP-result.TruePeakDBTP) > 0.01 {
+		t.Errorf("returned Result.TruePeakDBTP = %v does not match re-measured %v", result.TruePeakDBTP, reanalyzed.TruePeakDBTP)
+	}
+}
+
+func TestNormalizeToTargetSilenceIsNoop(t *testing.T) {
+	format := audio.Format{SampleRate: 48000, BitDepth: 16, Channels: 1, Encoding: audio.EncodingSignedLE}
+	samples := make([]int16, format.SampleRate)
+
+	result, err := NormalizeToTarget(samples, format, DefaultTarget)
+	if err != nil {
+		t.Fatalf("NormalizeToTarget: %v", err)
+	}
+	if !math.IsInf(result.IntegratedLUFS, -1) {
+		t.Errorf("IntegratedLUFS = %v, want -Inf for silence", result.IntegratedLUFS)
+	}
+	for _, s := range samples {
+		if s != 0 {
+			t.Fatalf("NormalizeToTarget mutated silent samples: got %d, want 0", s)
+		}
+	}
+}
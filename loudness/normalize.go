@@ -0,0 +1,65 @@
+package loudness
+
+import (
+	"math"
+
+	"github.com/pascalhuerst/alsa2fifo_indexer/audio"
+)
+
+// Target bundles the loudness normalization parameters used by
+// NormalizeToTarget.
+type Target struct {
+	LUFS         float64
+	TruePeakDBTP float64
+}
+
+// DefaultTarget is -16 LUFS integrated with a -1 dBTP true-peak ceiling,
+// replacing the previous `sox norm -0.1` peak normalization.
+var DefaultTarget = Target{LUFS: -16.0, TruePeakDBTP: -1.0}
+
+// NormalizeToTarget gain-adjusts samples in place so that its integrated
+// loudness matches target.LUFS, then attenuates further if needed to keep
+// the true peak at or below target.TruePeakDBTP (which takes priority:
+// the achieved loudness can fall short of target.LUFS when the peak
+// ceiling is the binding constraint). It returns the Result as actually
+// achieved by the gain applied to samples, not the pre-gain measurement -
+// callers deriving REPLAYGAIN_* tags from target minus this Result get
+// the residual gain still needed (0 dB in the common case, positive only
+// when the peak ceiling limited how much could be baked in), and the
+// true peak of the file being shipped rather than of the original.
+func NormalizeToTarget(samples []int16, format audio.Format, target Target) (Result, error) {
+	measured := AnalyzeSamples(samples, format)
+	if math.IsInf(measured.IntegratedLUFS, -1) {
+		return measured, nil
+	}
+
+	gainDB := target.LUFS - measured.IntegratedLUFS
+
+	peakAfterGain := measured.TruePeakDBTP + gainDB
+	if peakAfterGain > target.TruePeakDBTP {
+		gainDB -= peakAfterGain - target.TruePeakDBTP
+		peakAfterGain = target.TruePeakDBTP
+	}
+
+	applyGainDB(samples, gainDB)
+
+	return Result{
+		IntegratedLUFS:  measured.IntegratedLUFS + gainDB,
+		LoudnessRangeLU: measured.LoudnessRangeLU,
+		TruePeakDBTP:    peakAfterGain,
+	}, nil
+}
+
+func applyGainDB(samples []int16, gainDB float64) {
+	gain := math.Pow(10, gainDB/20)
+	for i, s := range samples {
+		v := float64(s) * gain
+		if v > math.MaxInt16 {
+			v = math.MaxInt16
+		}
+		if v < math.MinInt16 {
+			v = math.MinInt16
+		}
+		samples[i] = int16(v)
+	}
+}
@@ -0,0 +1,106 @@
+package loudness
+
+import (
+	"math"
+
+	"github.com/pascalhuerst/alsa2fifo_indexer/audio"
+)
+
+// oversampleFactor is the 4x oversampling rate BS.1770-4 Annex 2
+// recommends for true-peak estimation.
+const oversampleFactor = 4
+
+// oversampleFIR is a short low-pass polyphase FIR (windowed-sinc,
+// cutoff at the original Nyquist frequency) used to interpolate between
+// samples before peak detection, so that inter-sample peaks missed by
+// looking at integer samples alone are caught.
+var oversampleFIR = windowedSincLowpass(oversampleFactor, 16)
+
+// windowedSincLowpass builds a Hann-windowed sinc low-pass FIR with cutoff
+// 1/factor (relative to the oversampled rate) and the given number of taps
+// per phase on each side of the center.
+func windowedSincLowpass(factor, tapsPerSide int) []float64 {
+	n := factor*tapsPerSide*2 + 1
+	taps := make([]float64, n)
+	center := n / 2
+
+	for i := range taps {
+		x := float64(i-center) / float64(factor)
+		var sinc float64
+		if x == 0 {
+			sinc = 1
+		} else {
+			sinc = math.Sin(math.Pi*x) / (math.Pi * x)
+		}
+		window := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1))
+		taps[i] = sinc * window
+	}
+
+	return taps
+}
+
+// estimateTruePeakDBTP oversamples samples by oversampleFactor with a
+// polyphase FIR and returns the maximum absolute interpolated value in
+// dBTP (0 dBTP == full scale).
+func estimateTruePeakDBTP(samples []int16, format audio.Format) float64 {
+	channels := format.Channels
+	frames := len(samples) / channels
+	if frames == 0 {
+		return math.Inf(-1)
+	}
+
+	peak := 0.0
+	for c := 0; c < channels; c++ {
+		channel := make([]float64, frames)
+		for frame := 0; frame < frames; frame++ {
+			channel[frame] = float64(samples[frame*channels+c]) / 32768.0
+		}
+
+		for _, v := range polyphaseInterpolate(channel, oversampleFIR, oversampleFactor) {
+			abs := math.Abs(v)
+			if abs > peak {
+				peak = abs
+			}
+		}
+	}
+
+	if peak == 0 {
+		return math.Inf(-1)
+	}
+	return 20 * math.Log10(peak)
+}
+
+// polyphaseInterpolate returns the oversampled (by factor) interpolation
+// of x using FIR taps, evaluating one phase of the polyphase filter per
+// output sample. Samples the FIR window needs beyond x's edges are taken
+// as a replication of the nearest edge sample rather than zero: treating
+// them as zero is an implicit step down to silence at the boundary, and
+// the sinc FIR rings (Gibbs overshoot) on that discontinuity, which can
+// push a full-scale constant signal's estimated peak above 0 dBTP right
+// at the edges of the analysis window.
+func polyphaseInterpolate(x []float64, taps []float64, factor int) []float64 {
+	tapsPerPhase := len(taps) / factor
+	out := make([]float64, len(x)*factor)
+
+	for phase := 0; phase < factor; phase++ {
+		for n := range x {
+			var acc float64
+			for k := 0; k < tapsPerPhase; k++ {
+				srcIdx := n - k
+				if srcIdx < 0 {
+					srcIdx = 0
+				} else if srcIdx >= len(x) {
+					srcIdx = len(x) - 1
+				}
+				tapIdx := phase + k*factor
+				if tapIdx >= len(taps) {
+					continue
+				}
+				acc += x[srcIdx] * taps[tapIdx]
+			}
+			out[n*factor+phase] = acc
+		}
+	}
+
+	return out
+}
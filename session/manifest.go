@@ -0,0 +1,63 @@
+// Package session tracks the per-session manifest (session.json) written
+// alongside a closed recording: its declared capture format and any gaps
+// detected via the chunk header's sequence number.
+package session
+
+import (
+	"github.com/pascalhuerst/alsa2fifo_indexer/chunkheader"
+)
+
+// ManifestFileName is the file a session's Manifest is stored under,
+// next to data.wav/data.ogg/waveform.dat.
+const ManifestFileName = "session.json"
+
+// Gap records a run of missing chunk sequence numbers.
+type Gap struct {
+	AfterSequence uint64 `json:"after_sequence"`
+	MissingChunks uint64 `json:"missing_chunks"`
+}
+
+// Manifest records everything the indexer learned about a session from
+// its chunk headers: the recorder's declared capture format, and whether
+// any chunks were lost in transit.
+type Manifest struct {
+	RecorderID string               `json:"recorder_id"`
+	SessionID  string               `json:"session_id"`
+	SampleRate uint32               `json:"sample_rate"`
+	BitDepth   uint8                `json:"bit_depth"`
+	Channels   uint8                `json:"channels"`
+	Encoding   chunkheader.Encoding `json:"encoding"`
+	LastSeq    uint64               `json:"last_sequence"`
+	Gaps       []Gap                `json:"gaps,omitempty"`
+	Damaged    bool                 `json:"damaged"`
+}
+
+// NewManifest starts a Manifest from the first chunk header seen for a
+// session.
+func NewManifest(h chunkheader.Header) *Manifest {
+	return &Manifest{
+		RecorderID: h.RecorderID,
+		SessionID:  h.SessionID,
+		SampleRate: h.SampleRate,
+		BitDepth:   h.BitDepth,
+		Channels:   h.Channels,
+		Encoding:   h.Encoding,
+		LastSeq:    h.Sequence,
+	}
+}
+
+// Observe records a newly-arrived chunk's sequence number, extending the
+// manifest with a Gap (and marking it Damaged) if one or more sequence
+// numbers were skipped since the last chunk seen.
+func (m *Manifest) Observe(sequence uint64) {
+	if sequence > m.LastSeq+1 {
+		m.Gaps = append(m.Gaps, Gap{
+			AfterSequence: m.LastSeq,
+			MissingChunks: sequence - m.LastSeq - 1,
+		})
+		m.Damaged = true
+	}
+	if sequence > m.LastSeq {
+		m.LastSeq = sequence
+	}
+}
@@ -0,0 +1,45 @@
+// Package storage abstracts where chunks, sessions, recordings and
+// waveforms live, so the indexer and file server can run against local
+// disk, S3, or a SeaweedFS/filer cluster without their handlers knowing
+// which one is in play.
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ObjectInfo describes one stored object, returned by List and Stat.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// Backend is the storage operations the indexer and file server need.
+// Keys are '/'-separated, mirroring the directory layout the local disk
+// implementation previously hardcoded (e.g. "<recorderID>/<sessionID>/data.wav").
+type Backend interface {
+	// Put stores (or overwrites) key with the contents of r.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get opens key for reading. The caller must Close the result.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// List returns every object whose key starts with prefix.
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Delete removes key. Deleting a prefix removes everything under it.
+	Delete(ctx context.Context, key string) error
+	// Stat returns metadata for key without reading its contents.
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// PresignGet returns a URL clients can fetch key from directly for
+	// the given validity window, instead of proxying reads through the
+	// application server.
+	PresignGet(ctx context.Context, key string, expires time.Duration) (string, error)
+}
+
+// ErrNotExist is returned by Get/Stat when key does not exist.
+var ErrNotExist = errNotExist{}
+
+type errNotExist struct{}
+
+func (errNotExist) Error() string { return "storage: object does not exist" }
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LocalBackend stores objects as files under RootDir, preserving the
+// directory layout the server used before storage.Backend existed.
+type LocalBackend struct {
+	RootDir string
+	// URLPrefix is prepended to a key to build the URL PresignGet
+	// returns, e.g. "http://localhost:8234/files". Local disk has no
+	// native signed-URL mechanism, so this just points at a handler that
+	// serves objects through Get.
+	URLPrefix string
+}
+
+// NewLocalBackend returns a Backend rooted at rootDir, serving
+// presigned-looking URLs under urlPrefix.
+func NewLocalBackend(rootDir, urlPrefix string) *LocalBackend {
+	return &LocalBackend{RootDir: rootDir, URLPrefix: urlPrefix}
+}
+
+func (b *LocalBackend) path(key string) string {
+	return filepath.Join(b.RootDir, filepath.FromSlash(key))
+}
+
+// Put implements Backend.
+func (b *LocalBackend) Put(ctx context.Context, key string, r io.Reader) error {
+	path := b.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+	return err
+}
+
+// Get implements Backend.
+func (b *LocalBackend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(b.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	return f, err
+}
+
+// List implements Backend.
+func (b *LocalBackend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	root := b.path(prefix)
+
+	var objects []ObjectInfo
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(b.RootDir, path)
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, ObjectInfo{
+			Key:          filepath.ToSlash(rel),
+			Size:         info.Size(),
+			LastModified: info.ModTime(),
+		})
+		return nil
+	})
+
+	return objects, err
+}
+
+// Delete implements Backend. Deleting a directory prefix removes
+// everything under it, matching the `os.RemoveAll` retention behavior
+// this backend replaces.
+func (b *LocalBackend) Delete(ctx context.Context, key string) error {
+	return os.RemoveAll(b.path(key))
+}
+
+// Stat implements Backend.
+func (b *LocalBackend) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := os.Stat(b.path(key))
+	if os.IsNotExist(err) {
+		return ObjectInfo{}, ErrNotExist
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	return ObjectInfo{
+		Key:          key,
+		Size:         info.Size(),
+		LastModified: info.ModTime(),
+	}, nil
+}
+
+// PresignGet implements Backend. Local disk has no signed-URL mechanism,
+// so this returns a URL under URLPrefix that a handler backed by Get must
+// serve; expires is ignored.
+func (b *LocalBackend) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return fmt.Sprintf("%s/%s", strings.TrimSuffix(b.URLPrefix, "/"), key), nil
+}
+
+// ReadDirNames lists the immediate child names under prefix, the local
+// equivalent of the old `ioutil.ReadDir` recorder/session enumeration.
+func (b *LocalBackend) ReadDirNames(prefix string) ([]string, error) {
+	entries, err := ioutil.ReadDir(b.path(prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names, nil
+}
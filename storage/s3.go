@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3Backend stores objects in a single S3 bucket, one object per key, so
+// a deployment can scale the indexer/file server beyond a single node.
+type S3Backend struct {
+	Bucket string
+
+	client    *s3.Client
+	presigner *s3.PresignClient
+}
+
+// NewS3Backend returns a Backend backed by bucket, using client for
+// regular operations and its derived presign client for PresignGet.
+func NewS3Backend(client *s3.Client, bucket string) *S3Backend {
+	return &S3Backend{
+		Bucket:    bucket,
+		client:    client,
+		presigner: s3.NewPresignClient(client),
+	}
+}
+
+// Put implements Backend.
+func (b *S3Backend) Put(ctx context.Context, key string, r io.Reader) error {
+	_, err := b.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(key),
+		Body:   r,
+	})
+	return err
+}
+
+// Get implements Backend.
+func (b *S3Backend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := b.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(key),
+	})
+	if isNotFound(err) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// List implements Backend.
+func (b *S3Backend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+
+	paginator := s3.NewListObjectsV2Paginator(b.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.Bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			info := ObjectInfo{Key: aws.ToString(obj.Key)}
+			if obj.Size != nil {
+				info.Size = *obj.Size
+			}
+			if obj.LastModified != nil {
+				info.LastModified = *obj.LastModified
+			}
+			objects = append(objects, info)
+		}
+	}
+
+	return objects, nil
+}
+
+// Delete implements Backend. Deleting a prefix lists every object under
+// it and deletes them one request per object, since S3 has no
+// directory-delete primitive.
+func (b *S3Backend) Delete(ctx context.Context, key string) error {
+	objects, err := b.List(ctx, key)
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 {
+		_, err := b.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(b.Bucket),
+			Key:    aws.String(key),
+		})
+		return err
+	}
+
+	for _, obj := range objects {
+		if _, err := b.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(b.Bucket),
+			Key:    aws.String(obj.Key),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stat implements Backend.
+func (b *S3Backend) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	out, err := b.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(key),
+	})
+	if isNotFound(err) {
+		return ObjectInfo{}, ErrNotExist
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	info := ObjectInfo{Key: key}
+	if out.ContentLength != nil {
+		info.Size = *out.ContentLength
+	}
+	if out.LastModified != nil {
+		info.LastModified = *out.LastModified
+	}
+	return info, nil
+}
+
+// PresignGet implements Backend using S3's native presigned URLs.
+func (b *S3Backend) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	req, err := b.presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
+
+func isNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	return strings.Contains(err.Error(), "NotFound") || strings.Contains(err.Error(), "NoSuchKey")
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SeaweedFSBackend stores objects through a SeaweedFS filer's HTTP API
+// (https://github.com/seaweedfs/seaweedfs/wiki/Filer-Server-API), rooted
+// at a single filer path.
+type SeaweedFSBackend struct {
+	// FilerURL is the filer's base URL, e.g. "http://seaweed-filer:8888".
+	FilerURL string
+	// RootPath is prepended to every key, e.g. "/alsa2fifo".
+	RootPath string
+	Client   *http.Client
+}
+
+// NewSeaweedFSBackend returns a Backend against the filer at filerURL,
+// storing objects under rootPath.
+func NewSeaweedFSBackend(filerURL, rootPath string) *SeaweedFSBackend {
+	return &SeaweedFSBackend{
+		FilerURL: strings.TrimSuffix(filerURL, "/"),
+		RootPath: "/" + strings.Trim(rootPath, "/"),
+		Client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (b *SeaweedFSBackend) url(key string) string {
+	return b.FilerURL + b.RootPath + "/" + key
+}
+
+// Put implements Backend via a filer HTTP POST.
+func (b *SeaweedFSBackend) Put(ctx context.Context, key string, r io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.url(key), r)
+	if err != nil {
+		return err
+	}
+
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("storage: seaweedfs PUT %s: %s", key, resp.Status)
+	}
+	return nil
+}
+
+// Get implements Backend via a filer HTTP GET.
+func (b *SeaweedFSBackend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.url(key), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotExist
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("storage: seaweedfs GET %s: %s", key, resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+// List implements Backend via the filer's directory-listing JSON API
+// (GET on a directory with "Accept: application/json").
+func (b *SeaweedFSBackend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.url(prefix), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("storage: seaweedfs LIST %s: %s", prefix, resp.Status)
+	}
+
+	var listing struct {
+		Entries []struct {
+			FullPath string    `json:"FullPath"`
+			Mtime    time.Time `json:"Mtime"`
+			FileSize int64     `json:"FileSize"`
+		} `json:"Entries"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&listing); err != nil {
+		return nil, err
+	}
+
+	objects := make([]ObjectInfo, 0, len(listing.Entries))
+	for _, e := range listing.Entries {
+		objects = append(objects, ObjectInfo{
+			Key:          strings.TrimPrefix(e.FullPath, b.RootPath+"/"),
+			Size:         e.FileSize,
+			LastModified: e.Mtime,
+		})
+	}
+	return objects, nil
+}
+
+// Delete implements Backend via a filer HTTP DELETE, recursing when key
+// names a directory.
+func (b *SeaweedFSBackend) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, b.url(key)+"?recursive=true", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("storage: seaweedfs DELETE %s: %s", key, resp.Status)
+	}
+	return nil
+}
+
+// Stat implements Backend via a filer HTTP HEAD.
+func (b *SeaweedFSBackend) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, b.url(key), nil)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ObjectInfo{}, ErrNotExist
+	}
+	if resp.StatusCode >= 300 {
+		return ObjectInfo{}, fmt.Errorf("storage: seaweedfs HEAD %s: %s", key, resp.Status)
+	}
+
+	return ObjectInfo{Key: key, Size: resp.ContentLength}, nil
+}
+
+// PresignGet implements Backend. SeaweedFS serves objects directly from
+// its volume servers without a signing step, so this just returns the
+// filer URL; expires is ignored.
+func (b *SeaweedFSBackend) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return b.url(key), nil
+}
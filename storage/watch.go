@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Watcher replaces the old fsnotify-only invalidation with periodic
+// polling through List, since S3 and SeaweedFS only expose state that
+// way; changes are reported uniformly regardless of which backend is in
+// play. It uses no filesystem notifications, so on local disk too a
+// change is seen only at the next poll.
+type Watcher struct {
+	Backend  Backend
+	Prefix   string
+	Interval time.Duration
+
+	known map[string]time.Time
+}
+
+// NewWatcher returns a Watcher that reconciles everything under prefix on
+// backend every interval.
+func NewWatcher(backend Backend, prefix string, interval time.Duration) *Watcher {
+	return &Watcher{
+		Backend:  backend,
+		Prefix:   prefix,
+		Interval: interval,
+		known:    make(map[string]time.Time),
+	}
+}
+
+// Event describes one object appearing, changing, or disappearing since
+// the previous reconciliation.
+type Event struct {
+	Key  string
+	Kind EventKind
+}
+
+// EventKind identifies what changed about an object between polls.
+type EventKind int
+
+const (
+	EventCreated EventKind = iota
+	EventModified
+	EventDeleted
+)
+
+// Run polls the backend every w.Interval until ctx is cancelled, sending
+// one Event per created, modified, or deleted key to changes. Run blocks
+// until ctx is done (returning nil) or a poll fails (returning that
+// poll's error).
+func (w *Watcher) Run(ctx context.Context, changes chan<- Event) error {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	if err := w.poll(ctx, changes); err != nil {
+		return fmt.Errorf("storage: initial poll of %q: %w", w.Prefix, err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := w.poll(ctx, changes); err != nil {
+				return fmt.Errorf("storage: poll of %q: %w", w.Prefix, err)
+			}
+		}
+	}
+}
+
+func (w *Watcher) poll(ctx context.Context, changes chan<- Event) error {
+	objects, err := w.Backend.List(ctx, w.Prefix)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		seen[obj.Key] = true
+
+		lastModified, known := w.known[obj.Key]
+		switch {
+		case !known:
+			changes <- Event{Key: obj.Key, Kind: EventCreated}
+		case obj.LastModified.After(lastModified):
+			changes <- Event{Key: obj.Key, Kind: EventModified}
+		}
+		w.known[obj.Key] = obj.LastModified
+	}
+
+	for key := range w.known {
+		if !seen[key] {
+			changes <- Event{Key: key, Kind: EventDeleted}
+			delete(w.known, key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package stream
+
+import "encoding/binary"
+
+// aacFrameSamples is the fixed AAC access unit size (samples per channel).
+const aacFrameSamples = 1024
+
+// Encoder turns one AAC frame's worth of interleaved PCM samples into an
+// ADTS-framed AAC access unit. Production deployments plug in a real
+// encoder (e.g. a cgo binding to fdk-aac) through this interface; see
+// PassthroughEncoder for the dependency-free default.
+type Encoder interface {
+	Encode(pcm []int16, sampleRate, channels int) ([]byte, error)
+}
+
+// PassthroughEncoder packages raw PCM as an ADTS-style access unit without
+// psychoacoustic compression. It lets the live streaming endpoints serve
+// playlists, segments and FLV tags without a real AAC encoder, but the
+// payload is uncompressed S16LE PCM behind a header that declares AAC LC,
+// so standard AAC decoders cannot play it; a real AAC encoder plugs in
+// through Encoder.
+type PassthroughEncoder struct{}
+
+// Encode implements Encoder.
+func (PassthroughEncoder) Encode(pcm []int16, sampleRate, channels int) ([]byte, error) {
+	payload := make([]byte, len(pcm)*2)
+	for i, s := range pcm {
+		binary.LittleEndian.PutUint16(payload[2*i:], uint16(s))
+	}
+
+	accessUnit := append(adtsHeader(len(payload), sampleRate, channels), payload...)
+	return accessUnit, nil
+}
+
+// adtsSampleRateIndex maps common sample rates to the ADTS header's
+// sampling_frequency_index table.
+func adtsSampleRateIndex(sampleRate int) byte {
+	switch sampleRate {
+	case 48000:
+		return 3
+	case 44100:
+		return 4
+	case 32000:
+		return 5
+	default:
+		return 3
+	}
+}
+
+// adtsHeader builds the 7-byte fixed+variable ADTS header (no CRC)
+// preceding each AAC access unit in the elementary stream.
+func adtsHeader(payloadLen, sampleRate, channels int) []byte {
+	frameLen := payloadLen + 7
+
+	header := make([]byte, 7)
+	header[0] = 0xff
+	header[1] = 0xf1 // MPEG-4, no CRC
+	header[2] = (1 << 6) | (adtsSampleRateIndex(sampleRate) << 2) | byte(channels>>2)
+	header[3] = byte(channels&0x3)<<6 | byte(frameLen>>11)
+	header[4] = byte(frameLen >> 3)
+	header[5] = byte(frameLen<<5) | 0x1f
+	header[6] = 0xfc
+	return header
+}
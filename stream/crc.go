@@ -0,0 +1,19 @@
+package stream
+
+// mpegCRC32 computes the CRC32/MPEG-2 checksum (polynomial 0x04c11db7, no
+// reflection, initial value 0xffffffff) MPEG-TS PSI tables are terminated
+// with.
+func mpegCRC32(data []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = (crc << 1) ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
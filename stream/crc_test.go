@@ -0,0 +1,11 @@
+package stream
+
+import "testing"
+
+func TestMpegCRC32(t *testing.T) {
+	// Known CRC32/MPEG-2 vector: crc("123456789") == 0x0376e6e7.
+	got := mpegCRC32([]byte("123456789"))
+	if want := uint32(0x0376e6e7); got != want {
+		t.Fatalf("mpegCRC32(%q) = %#08x, want %#08x", "123456789", got, want)
+	}
+}
@@ -0,0 +1,58 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// flvHeader is the 9-byte FLV file signature (audio-only, no video),
+// followed by the mandatory 4-byte PreviousTagSize0 of 0.
+func flvHeader() []byte {
+	h := []byte{'F', 'L', 'V', 0x01, 0x04, 0x00, 0x00, 0x00, 0x09}
+	return append(h, 0, 0, 0, 0)
+}
+
+// flvAudioTag wraps one AAC access unit (minus its ADTS header, which FLV
+// does not carry) in an FLV AUDIODATA tag plus its trailing PreviousTagSize,
+// for HTTP-FLV clients that can't parse HLS.
+func flvAudioTag(aacRaw []byte, timestampMS uint32, sequenceHeader bool) []byte {
+	packetType := byte(1) // AAC raw
+	if sequenceHeader {
+		packetType = 0
+	}
+
+	body := make([]byte, 0, len(aacRaw)+2)
+	body = append(body, 0xaf, packetType) // SoundFormat=AAC, rate/size/type bits, AACPacketType
+	body = append(body, aacRaw...)
+
+	var tag bytes.Buffer
+	tag.WriteByte(8) // TagType = audio
+	writeUint24(&tag, uint32(len(body)))
+	writeUint24(&tag, timestampMS&0xffffff)
+	tag.WriteByte(byte(timestampMS >> 24)) // timestamp extended byte
+	writeUint24(&tag, 0)                   // StreamID, always 0
+	tag.Write(body)
+
+	full := tag.Bytes()
+	out := make([]byte, len(full)+4)
+	copy(out, full)
+	binary.BigEndian.PutUint32(out[len(full):], uint32(len(full)))
+
+	return out
+}
+
+func writeUint24(b *bytes.Buffer, v uint32) {
+	b.WriteByte(byte(v >> 16))
+	b.WriteByte(byte(v >> 8))
+	b.WriteByte(byte(v))
+}
+
+// stripADTS removes the 7-byte ADTS header PassthroughEncoder (and most
+// real AAC encoders) prefix each access unit with, since FLV's AUDIODATA
+// carries raw AAC payload instead.
+func stripADTS(accessUnit []byte) []byte {
+	if len(accessUnit) <= 7 {
+		return nil
+	}
+	return accessUnit[7:]
+}
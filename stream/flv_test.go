@@ -0,0 +1,50 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestFLVHeader(t *testing.T) {
+	h := flvHeader()
+	if !bytes.HasPrefix(h, []byte{'F', 'L', 'V'}) {
+		t.Fatalf("flvHeader() = %v, want FLV signature prefix", h)
+	}
+	if len(h) != 13 {
+		t.Fatalf("flvHeader() length = %d, want 13 (9-byte header + 4-byte PreviousTagSize0)", len(h))
+	}
+}
+
+func TestFLVAudioTagRoundTrip(t *testing.T) {
+	accessUnit := append(adtsHeader(32, 48000, 2), make([]byte, 32)...)
+	aacRaw := stripADTS(accessUnit)
+
+	tag := flvAudioTag(aacRaw, 1234, false)
+
+	if tag[0] != 8 {
+		t.Fatalf("TagType = %d, want 8 (audio)", tag[0])
+	}
+
+	bodyLen := int(tag[1])<<16 | int(tag[2])<<8 | int(tag[3])
+	if want := len(aacRaw) + 2; bodyLen != want {
+		t.Fatalf("body length field = %d, want %d", bodyLen, want)
+	}
+
+	prevTagSize := binary.BigEndian.Uint32(tag[len(tag)-4:])
+	if want := uint32(len(tag) - 4); prevTagSize != want {
+		t.Fatalf("trailing PreviousTagSize = %d, want %d", prevTagSize, want)
+	}
+}
+
+func TestStripADTS(t *testing.T) {
+	accessUnit := append(adtsHeader(10, 48000, 2), make([]byte, 10)...)
+	raw := stripADTS(accessUnit)
+	if len(raw) != 10 {
+		t.Fatalf("stripADTS length = %d, want 10", len(raw))
+	}
+
+	if got := stripADTS(make([]byte, 7)); got != nil {
+		t.Fatalf("stripADTS of a too-short access unit = %v, want nil", got)
+	}
+}
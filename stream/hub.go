@@ -0,0 +1,151 @@
+// Package stream exposes each active recorder's chunk stream as live
+// HLS and HTTP-FLV endpoints, so recorders can be monitored while a
+// session is still open instead of only after it closes.
+package stream
+
+import (
+	"sync"
+	"time"
+)
+
+// ringBufferDepth bounds how many un-delivered PCM chunks a slow
+// subscriber can fall behind by before its oldest chunk is dropped.
+const ringBufferDepth = 32
+
+// subscriberIdleTimeout prunes subscribers (e.g. an HTTP client that
+// disconnected without the server noticing) that haven't pulled a chunk
+// in this long.
+const subscriberIdleTimeout = 30 * time.Second
+
+// Hub fans PCM chunks uploaded for one recorder out to any number of live
+// subscribers (HLS/FLV encoders serving HTTP clients), dropping the
+// oldest buffered chunk for a subscriber that can't keep up.
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+}
+
+type subscriber struct {
+	ch       chan []byte
+	lastPull time.Time
+}
+
+// NewHub returns an empty Hub.
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[*subscriber]struct{})}
+}
+
+// Publish fans pcm out to every subscriber, dropping the oldest buffered
+// chunk first for any subscriber whose buffer is full (drop-oldest
+// semantics) rather than blocking the uploader.
+func (h *Hub) Publish(pcm []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers {
+		select {
+		case sub.ch <- pcm:
+		default:
+			select {
+			case <-sub.ch:
+			default:
+			}
+			select {
+			case sub.ch <- pcm:
+			default:
+			}
+		}
+	}
+}
+
+// Subscribe registers a new subscriber and returns the channel it
+// receives PCM chunks on, a touch func the caller must invoke every time
+// it successfully reads a chunk (so PruneIdle can tell an active reader
+// from an abandoned one), and an unsubscribe func the caller must call
+// when it's done (e.g. when the HTTP client disconnects).
+func (h *Hub) Subscribe() (ch <-chan []byte, touch func(), unsubscribe func()) {
+	sub := &subscriber{
+		ch:       make(chan []byte, ringBufferDepth),
+		lastPull: time.Now(),
+	}
+
+	h.mu.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.mu.Unlock()
+
+	touch = func() {
+		h.mu.Lock()
+		sub.lastPull = time.Now()
+		h.mu.Unlock()
+	}
+
+	unsubscribe = func() {
+		h.mu.Lock()
+		delete(h.subscribers, sub)
+		h.mu.Unlock()
+	}
+
+	return sub.ch, touch, unsubscribe
+}
+
+// PruneIdle removes subscribers that haven't been read from in longer
+// than subscriberIdleTimeout, for HTTP clients that went away without a
+// clean disconnect, closing each pruned subscriber's channel so a
+// blocked reader observes closure and exits instead of hanging forever.
+func (h *Hub) PruneIdle() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers {
+		if time.Since(sub.lastPull) > subscriberIdleTimeout {
+			delete(h.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// SubscriberCount returns the number of currently registered subscribers.
+func (h *Hub) SubscriberCount() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
+
+// Hubs tracks one Hub per recorder ID, created lazily on first use.
+type Hubs struct {
+	mu   sync.Mutex
+	byID map[string]*Hub
+}
+
+// NewHubs returns an empty Hubs registry.
+func NewHubs() *Hubs {
+	return &Hubs{byID: make(map[string]*Hub)}
+}
+
+// For returns the Hub for recorderID, creating it if this is the first
+// time that recorder has been seen.
+func (hs *Hubs) For(recorderID string) *Hub {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	h, ok := hs.byID[recorderID]
+	if !ok {
+		h = NewHub()
+		hs.byID[recorderID] = h
+	}
+	return h
+}
+
+// PruneIdle runs Hub.PruneIdle on every known recorder's Hub.
+func (hs *Hubs) PruneIdle() {
+	hs.mu.Lock()
+	hubs := make([]*Hub, 0, len(hs.byID))
+	for _, h := range hs.byID {
+		hubs = append(hubs, h)
+	}
+	hs.mu.Unlock()
+
+	for _, h := range hubs {
+		h.PruneIdle()
+	}
+}
@@ -0,0 +1,137 @@
+package stream
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// segmentDuration is the target length of each `.ts` segment.
+const segmentDuration = 2 * time.Second
+
+// windowSize is the number of segments kept in the sliding HLS window.
+const windowSize = 6
+
+// segment is one encoded, muxed chunk of the live stream.
+type segment struct {
+	sequence int
+	data     []byte
+	duration time.Duration
+}
+
+// Segmenter consumes raw PCM chunks for one recorder, encodes them to AAC
+// and packages the result into a rolling window of MPEG-TS segments, the
+// live equivalent of the WAV/OGG files closeSession produces once a
+// session ends.
+type Segmenter struct {
+	format struct {
+		sampleRate int
+		channels   int
+	}
+	encoder Encoder
+
+	mu          sync.Mutex
+	pending     []int16
+	window      []segment
+	nextSeq     int
+	mediaSeqOff int
+	muxer       *tsMuxer
+}
+
+// NewSegmenter returns a Segmenter for PCM in the given sample rate and
+// channel count, using enc to produce AAC access units.
+func NewSegmenter(sampleRate, channels int, enc Encoder) *Segmenter {
+	s := &Segmenter{encoder: enc, muxer: newTSMuxer()}
+	s.format.sampleRate = sampleRate
+	s.format.channels = channels
+	return s
+}
+
+// Write accepts a raw S16LE PCM chunk, buffering and encoding complete
+// segments as enough audio accumulates.
+func (s *Segmenter) Write(pcm []int16) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending = append(s.pending, pcm...)
+
+	framesPerSegment := int(segmentDuration.Seconds()) * s.format.sampleRate
+	samplesPerSegment := framesPerSegment * s.format.channels
+
+	for len(s.pending) >= samplesPerSegment {
+		segSamples := s.pending[:samplesPerSegment]
+		s.pending = s.pending[samplesPerSegment:]
+
+		tsData, err := s.encodeSegment(segSamples)
+		if err != nil {
+			return fmt.Errorf("stream: cannot encode segment: %w", err)
+		}
+
+		s.window = append(s.window, segment{
+			sequence: s.nextSeq,
+			data:     tsData,
+			duration: segmentDuration,
+		})
+		s.nextSeq++
+
+		if len(s.window) > windowSize {
+			s.window = s.window[1:]
+			s.mediaSeqOff++
+		}
+	}
+
+	return nil
+}
+
+func (s *Segmenter) encodeSegment(samples []int16) ([]byte, error) {
+	frameLen := aacFrameSamples * s.format.channels
+
+	var frames [][]byte
+	for offset := 0; offset < len(samples); offset += frameLen {
+		end := offset + frameLen
+		if end > len(samples) {
+			end = len(samples)
+		}
+		frame, err := s.encoder.Encode(samples[offset:end], s.format.sampleRate, s.format.channels)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, frame)
+	}
+
+	return s.muxer.Segment(frames, 0), nil
+}
+
+// Playlist renders the current sliding-window HLS media playlist.
+func (s *Segmenter) Playlist(recorderID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:3\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(segmentDuration.Seconds())+1)
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", s.mediaSeqOff)
+
+	for _, seg := range s.window {
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n", seg.duration.Seconds())
+		fmt.Fprintf(&b, "%s-%d.ts\n", recorderID, seg.sequence)
+	}
+
+	return b.String()
+}
+
+// Segment returns the TS payload for the given sequence number, if it is
+// still within the sliding window.
+func (s *Segmenter) Segment(sequence int) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, seg := range s.window {
+		if seg.sequence == sequence {
+			return seg.data, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,202 @@
+package stream
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often idle HTTP-FLV/HLS subscribers are swept.
+const pruneInterval = 10 * time.Second
+
+// Server exposes the live HLS/HTTP-FLV endpoints backed by a Hubs
+// registry that the chunk uploader publishes newly-arrived PCM into.
+type Server struct {
+	hubs   *Hubs
+	format struct {
+		sampleRate int
+		channels   int
+	}
+	newEncoder func() Encoder
+
+	mu         sync.Mutex
+	segmenters map[string]*Segmenter
+}
+
+// NewServer returns a Server for PCM chunks in the given sample rate and
+// channel count. newEncoder is called once per recorder to build the AAC
+// encoder its Segmenter uses; pass a func returning PassthroughEncoder{}
+// for the dependency-free default.
+func NewServer(sampleRate, channels int, newEncoder func() Encoder) *Server {
+	s := &Server{
+		hubs:       NewHubs(),
+		newEncoder: newEncoder,
+		segmenters: make(map[string]*Segmenter),
+	}
+	s.format.sampleRate = sampleRate
+	s.format.channels = channels
+
+	go s.pruneLoop()
+
+	return s
+}
+
+func (s *Server) pruneLoop() {
+	for range time.Tick(pruneInterval) {
+		s.hubs.PruneIdle()
+	}
+}
+
+// Publish fans a raw PCM chunk out to recorderID's live subscribers. The
+// upload handler should call this for every chunk it accepts.
+func (s *Server) Publish(recorderID string, pcm []int16) {
+	s.segmenterFor(recorderID).Write(pcm)
+
+	pcmBytes := make([]byte, len(pcm)*2)
+	for i, v := range pcm {
+		pcmBytes[2*i] = byte(v)
+		pcmBytes[2*i+1] = byte(v >> 8)
+	}
+	s.hubs.For(recorderID).Publish(pcmBytes)
+}
+
+func (s *Server) segmenterFor(recorderID string) *Segmenter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seg, ok := s.segmenters[recorderID]
+	if !ok {
+		seg = NewSegmenter(s.format.sampleRate, s.format.channels, s.newEncoder())
+		s.segmenters[recorderID] = seg
+	}
+	return seg
+}
+
+// RegisterRoutes wires the /live/ HLS and HTTP-FLV endpoints into mux.
+func (s *Server) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/live/", s.serveHLS)
+}
+
+func (s *Server) serveHLS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+
+	path := strings.TrimPrefix(r.URL.Path, "/live/")
+
+	switch {
+	case strings.HasSuffix(path, ".flv"):
+		recorderID := strings.TrimSuffix(path, ".flv")
+		s.serveFLV(w, r, recorderID)
+
+	case strings.HasSuffix(path, "/index.m3u8"):
+		recorderID := strings.TrimSuffix(path, "/index.m3u8")
+		s.servePlaylist(w, recorderID)
+
+	case strings.HasSuffix(path, ".ts"):
+		s.serveSegment(w, path)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) servePlaylist(w http.ResponseWriter, recorderID string) {
+	s.mu.Lock()
+	seg, ok := s.segmenters[recorderID]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	fmt.Fprint(w, seg.Playlist(recorderID))
+}
+
+func (s *Server) serveSegment(w http.ResponseWriter, path string) {
+	// path is "{recorderID}/{recorderID}-{sequence}.ts" (the playlist at
+	// {recorderID}/index.m3u8 lists segments by relative URI) or
+	// "{recorderID}-{sequence}.ts".
+	trimmed := strings.TrimSuffix(path, ".ts")
+	if slash := strings.LastIndex(trimmed, "/"); slash >= 0 {
+		trimmed = trimmed[slash+1:]
+	}
+	idx := strings.LastIndex(trimmed, "-")
+	if idx < 0 {
+		http.NotFound(w, nil)
+		return
+	}
+	recorderID := trimmed[:idx]
+	sequence, err := strconv.Atoi(trimmed[idx+1:])
+	if err != nil {
+		http.NotFound(w, nil)
+		return
+	}
+
+	s.mu.Lock()
+	seg, ok := s.segmenters[recorderID]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, nil)
+		return
+	}
+
+	data, ok := seg.Segment(sequence)
+	if !ok {
+		http.NotFound(w, nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "video/mp2t")
+	w.Write(data)
+}
+
+func (s *Server) serveFLV(w http.ResponseWriter, r *http.Request, recorderID string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "video/x-flv")
+	w.Write(flvHeader())
+	flusher.Flush()
+
+	ch, touch, unsubscribe := s.hubs.For(recorderID).Subscribe()
+	defer unsubscribe()
+
+	enc := s.newEncoder()
+	timestampMS := uint32(0)
+	frameSamples := aacFrameSamples * s.format.channels
+	var pending []int16
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case chunk, ok := <-ch:
+			if !ok {
+				return
+			}
+			touch()
+			for i := 0; i+1 < len(chunk); i += 2 {
+				pending = append(pending, int16(chunk[i])|int16(chunk[i+1])<<8)
+			}
+
+			for len(pending) >= frameSamples {
+				frame, err := enc.Encode(pending[:frameSamples], s.format.sampleRate, s.format.channels)
+				pending = pending[frameSamples:]
+				if err != nil {
+					continue
+				}
+
+				w.Write(flvAudioTag(stripADTS(frame), timestampMS, false))
+				flusher.Flush()
+				timestampMS += uint32(1000 * aacFrameSamples / s.format.sampleRate)
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+
+	patPID = 0x0000
+	pmtPID = 0x1000
+	aacPID = 0x0100
+
+	streamTypeAACADTS = 0x0f
+)
+
+// tsMuxer packages ADTS AAC access units into an MPEG-TS elementary
+// stream, replacing the container a live HLS/HTTP-FLV client expects in
+// place of the WAV/OGG files produced once a session is closed.
+type tsMuxer struct {
+	continuity map[int]byte
+}
+
+func newTSMuxer() *tsMuxer {
+	return &tsMuxer{continuity: map[int]byte{}}
+}
+
+// Segment muxes one segment's worth of ADTS AAC frames into a `.ts` file,
+// prefixing it with PAT/PMT tables the way every segment in an HLS
+// playlist is expected to be self-contained.
+func (m *tsMuxer) Segment(adtsFrames [][]byte, ptsBase int64) []byte {
+	var out bytes.Buffer
+
+	out.Write(m.patPacket())
+	out.Write(m.pmtPacket())
+
+	pts := ptsBase
+	for _, frame := range adtsFrames {
+		out.Write(m.pesPackets(frame, pts))
+		// 1024 samples per AAC frame at a 90kHz PTS clock.
+		pts += 1024 * 90000 / 48000
+	}
+
+	return out.Bytes()
+}
+
+func (m *tsMuxer) patPacket() []byte {
+	section := []byte{
+		0x00,       // table id
+		0xb0, 0x0d, // section_syntax_indicator + section_length
+		0x00, 0x01, // transport_stream_id
+		0xc1,       // version, current_next_indicator
+		0x00, 0x00, // section_number, last_section_number
+		0x00, 0x01, // program_number 1
+		0xe0 | byte(pmtPID>>8), byte(pmtPID&0xff),
+	}
+	section = appendCRC32(section)
+	return m.packetize(patPID, psiPayload(section), true)
+}
+
+func (m *tsMuxer) pmtPacket() []byte {
+	section := []byte{
+		0x02,       // table id
+		0xb0, 0x12, // section_syntax_indicator + section_length (18)
+		0x00, 0x01, // program_number
+		0xc1, 0x00, 0x00, // version/current_next, section_number, last_section_number
+		0xe0 | byte(aacPID>>8), byte(aacPID&0xff), // PCR PID
+		0xf0, 0x00, // program_info_length = 0
+		streamTypeAACADTS,
+		0xe0 | byte(aacPID>>8), byte(aacPID&0xff),
+		0xf0, 0x00, // ES_info_length = 0
+	}
+	section = appendCRC32(section)
+	return m.packetize(pmtPID, psiPayload(section), true)
+}
+
+func psiPayload(section []byte) []byte {
+	return append([]byte{0x00}, section...) // pointer_field = 0
+}
+
+func appendCRC32(section []byte) []byte {
+	crc := mpegCRC32(section)
+	out := make([]byte, len(section)+4)
+	copy(out, section)
+	binary.BigEndian.PutUint32(out[len(section):], crc)
+	return out
+}
+
+// pesPackets wraps one AAC access unit in a PES header and splits the
+// result into 188-byte TS packets on aacPID.
+func (m *tsMuxer) pesPackets(accessUnit []byte, pts int64) []byte {
+	pes := buildPES(accessUnit, pts)
+	return m.packetize(aacPID, pes, true)
+}
+
+func buildPES(payload []byte, pts int64) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0x00, 0x00, 0x01, 0xc0}) // packet_start_code_prefix + stream_id (audio)
+
+	headerDataLen := byte(5)
+	pesPacketLen := len(payload) + int(headerDataLen) + 3
+
+	b.WriteByte(byte(pesPacketLen >> 8))
+	b.WriteByte(byte(pesPacketLen))
+	b.WriteByte(0x80)             // marker bits, no scrambling
+	b.WriteByte(0x80)             // PTS present
+	b.WriteByte(headerDataLen)
+
+	b.Write(encodePTS(pts, 0x2))
+	b.Write(payload)
+
+	return b.Bytes()
+}
+
+func encodePTS(pts int64, prefix byte) []byte {
+	out := make([]byte, 5)
+	out[0] = (prefix << 4) | byte((pts>>30)&0x07)<<1 | 0x01
+	out[1] = byte(pts >> 22)
+	out[2] = byte((pts>>15)&0x7f)<<1 | 0x01
+	out[3] = byte(pts >> 7)
+	out[4] = byte((pts&0x7f)<<1) | 0x01
+	return out
+}
+
+// packetize splits payload into 188-byte TS packets on pid, setting
+// payload_unit_start_indicator on the first packet and padding the final
+// packet with 0xff stuffing bytes.
+func (m *tsMuxer) packetize(pid int, payload []byte, unitStart bool) []byte {
+	var out bytes.Buffer
+
+	for offset := 0; offset < len(payload); {
+		packet := make([]byte, tsPacketSize)
+		packet[0] = tsSyncByte
+
+		pusi := byte(0)
+		if unitStart && offset == 0 {
+			pusi = 0x40
+		}
+		packet[1] = pusi | byte(pid>>8)
+		packet[2] = byte(pid)
+		packet[3] = 0x10 | m.continuity[pid]
+		m.continuity[pid] = (m.continuity[pid] + 1) & 0x0f
+
+		headerLen := 4
+		n := copy(packet[headerLen:], payload[offset:])
+		offset += n
+
+		if headerLen+n < tsPacketSize {
+			for i := headerLen + n; i < tsPacketSize; i++ {
+				packet[i] = 0xff
+			}
+		}
+
+		out.Write(packet)
+	}
+
+	return out.Bytes()
+}
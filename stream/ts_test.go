@@ -0,0 +1,56 @@
+package stream
+
+import "testing"
+
+func TestTSMuxerSegmentPacketsAreWellFormed(t *testing.T) {
+	m := newTSMuxer()
+
+	frames := [][]byte{
+		make([]byte, 64),
+		make([]byte, 64),
+	}
+	out := m.Segment(frames, 0)
+
+	if len(out)%tsPacketSize != 0 {
+		t.Fatalf("Segment output length %d is not a multiple of %d", len(out), tsPacketSize)
+	}
+	if len(out) == 0 {
+		t.Fatal("Segment produced no packets")
+	}
+
+	for offset := 0; offset < len(out); offset += tsPacketSize {
+		if out[offset] != tsSyncByte {
+			t.Fatalf("packet at offset %d: sync byte = %#02x, want %#02x", offset, out[offset], tsSyncByte)
+		}
+	}
+}
+
+func TestTSMuxerContinuityCounterIncrements(t *testing.T) {
+	m := newTSMuxer()
+
+	payload := make([]byte, tsPacketSize*3) // forces several packets on the same PID
+	packets := m.packetize(aacPID, payload, true)
+
+	var gotCC []byte
+	for offset := 0; offset < len(packets); offset += tsPacketSize {
+		gotCC = append(gotCC, packets[offset+3]&0x0f)
+	}
+
+	for i := 1; i < len(gotCC); i++ {
+		want := (gotCC[i-1] + 1) & 0x0f
+		if gotCC[i] != want {
+			t.Fatalf("continuity counter at packet %d = %d, want %d", i, gotCC[i], want)
+		}
+	}
+}
+
+func TestTSMuxerPMTReferencesAACPID(t *testing.T) {
+	m := newTSMuxer()
+	pmt := m.pmtPacket()
+
+	// The PMT packet carries pmtPID in its TS header.
+	gotPID := int(pmt[1]&0x1f)<<8 | int(pmt[2])
+	if gotPID != pmtPID {
+		t.Fatalf("pmtPacket TS header PID = %#04x, want %#04x", gotPID, pmtPID)
+	}
+}
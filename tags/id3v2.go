@@ -0,0 +1,62 @@
+package tags
+
+import (
+	"strconv"
+
+	"github.com/bogem/id3v2"
+)
+
+// WriteID3v2 opens the already-encoded MP3 or WAV file at path and writes
+// t as ID3v2 frames, attaching artwork as the front cover picture if
+// given. Custom fields are written as TXXX frames, the ID3v2 mechanism
+// ReplayGain-aware players look for REPLAYGAIN_* values in.
+func WriteID3v2(path string, t TagSet, artwork []byte) error {
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		return err
+	}
+	defer tag.Close()
+
+	if t.Artist != "" {
+		tag.SetArtist(t.Artist)
+	}
+	if t.Title != "" {
+		tag.SetTitle(t.Title)
+	}
+	if t.Album != "" {
+		tag.SetAlbum(t.Album)
+	}
+	if t.Genre != "" {
+		tag.SetGenre(t.Genre)
+	}
+	if t.TrackNumber > 0 {
+		tag.AddTextFrame(tag.CommonID("Track number/Position in set"), id3v2.EncodingUTF8, strconv.Itoa(t.TrackNumber))
+	}
+	if t.Comment != "" {
+		tag.AddCommentFrame(id3v2.CommentFrame{
+			Encoding: id3v2.EncodingUTF8,
+			Language: "eng",
+			Text:     t.Comment,
+		})
+	}
+
+	for description, value := range t.Custom {
+		tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+			Encoding:    id3v2.EncodingUTF8,
+			Description: description,
+			Value:       value,
+		})
+	}
+
+	if len(artwork) > 0 {
+		tag.AddAttachedPicture(id3v2.PictureFrame{
+			Encoding:    id3v2.EncodingUTF8,
+			MimeType:    "image/png",
+			PictureType: id3v2.PTFrontCover,
+			Description: "Front cover",
+			Picture:     artwork,
+		})
+	}
+
+	return tag.Save()
+}
@@ -0,0 +1,59 @@
+// Package tags resolves the per-segment metadata a rendered recording is
+// tagged with and writes it in whichever native format its container
+// expects (ID3v2 for MP3/WAV, Vorbis Comments for Ogg/Opus).
+//
+// FLAC's native metadata block is not implemented: audio.Encoder has no
+// FLAC encoder to tag the output of (see the audio package doc), so there
+// is no caller that would ever exercise it. Add a FLAC metadata-block
+// writer here alongside a FLACEncoder if that changes.
+package tags
+
+import (
+	"strconv"
+	"strings"
+)
+
+// TagSet is the resolved metadata for one rendered recording, independent
+// of which container format eventually stores it.
+type TagSet struct {
+	Artist      string            `json:"artist,omitempty"`
+	Title       string            `json:"title,omitempty"`
+	Album       string            `json:"album,omitempty"`
+	Genre       string            `json:"genre,omitempty"`
+	Comment     string            `json:"comment,omitempty"`
+	TrackNumber int               `json:"trackNumber,omitempty"`
+	Custom      map[string]string `json:"custom,omitempty"`
+	ArtworkURL  string            `json:"artworkURL,omitempty"`
+	ArtworkHash string            `json:"artworkHash,omitempty"`
+}
+
+// VorbisComments returns t as the uppercase FIELD=value pairs Vorbis
+// Comments (Ogg/Opus's native metadata format) use, folding in Custom
+// as-is so callers can carry extra fields like REPLAYGAIN_TRACK_GAIN.
+func (t TagSet) VorbisComments() map[string]string {
+	comments := make(map[string]string, len(t.Custom)+6)
+
+	if t.Artist != "" {
+		comments["ARTIST"] = t.Artist
+	}
+	if t.Title != "" {
+		comments["TITLE"] = t.Title
+	}
+	if t.Album != "" {
+		comments["ALBUM"] = t.Album
+	}
+	if t.Genre != "" {
+		comments["GENRE"] = t.Genre
+	}
+	if t.Comment != "" {
+		comments["COMMENT"] = t.Comment
+	}
+	if t.TrackNumber > 0 {
+		comments["TRACKNUMBER"] = strconv.Itoa(t.TrackNumber)
+	}
+	for k, v := range t.Custom {
+		comments[strings.ToUpper(k)] = v
+	}
+
+	return comments
+}